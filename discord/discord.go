@@ -0,0 +1,177 @@
+// Package discord verifies and answers Discord interactions delivered to an
+// outgoing webhook endpoint.
+package discord
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Anything older is treated as a replay.
+const maxRequestAge = 5 * time.Minute
+
+var (
+	ErrBadSignature = errors.New("discord: bad request signature")
+	ErrStale        = errors.New("discord: request timestamp too old")
+)
+
+// APIURL is where replies to deferred interactions are sent.
+var APIURL = "https://discord.com/api/v10"
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Interaction types.
+const (
+	Ping               = 1
+	ApplicationCommand = 2
+)
+
+// Interaction response types.
+const (
+	Pong                             = 1
+	ChannelMessageWithSource         = 4
+	DeferredChannelMessageWithSource = 5
+)
+
+// ParsePublicKey decodes an application's hex encoded public key.
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	b, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("discord: public key is %d bytes, want %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Verify checks the request's Ed25519 signature and timestamp and returns
+// its body.
+func Verify(request *http.Request, key ed25519.PublicKey) ([]byte, error) {
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := request.Header.Get("X-Signature-Timestamp")
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	if age := time.Since(time.Unix(secs, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return nil, ErrStale
+	}
+	signature, err := hex.DecodeString(request.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, ErrBadSignature
+	}
+	message := append([]byte(timestamp), body...)
+	if !ed25519.Verify(key, message, signature) {
+		return nil, ErrBadSignature
+	}
+	return body, nil
+}
+
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Interaction is a PING or a slash command invocation.
+type Interaction struct {
+	ID            string `json:"id"`
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Data          struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+	// Member is set in guilds, User in DMs.
+	Member *struct {
+		User User `json:"user"`
+	} `json:"member"`
+	User *User `json:"user"`
+}
+
+// Option returns the string value of the named command option.
+func (i Interaction) Option(name string) string {
+	for _, opt := range i.Data.Options {
+		if opt.Name == name {
+			s, _ := opt.Value.(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// UserID returns the invoking user's id.
+func (i Interaction) UserID() string {
+	if i.Member != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+type Response struct {
+	Type int      `json:"type"`
+	Data *Message `json:"data,omitempty"`
+}
+
+type Message struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []Embed `json:"embeds,omitempty"`
+	Flags   int     `json:"flags,omitempty"`
+}
+
+// Ephemeral is the message flag that hides a reply from everyone but the
+// invoking user.
+const Ephemeral = 1 << 6
+
+type Embed struct {
+	Title string      `json:"title,omitempty"`
+	URL   string      `json:"url,omitempty"`
+	Image *EmbedImage `json:"image,omitempty"`
+}
+
+type EmbedImage struct {
+	URL string `json:"url"`
+}
+
+// EditOriginal replaces the reply to a deferred interaction.
+func EditOriginal(interaction Interaction, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", APIURL, interaction.ApplicationID, interaction.Token)
+	req, err := http.NewRequest("PATCH", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("discord responded %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
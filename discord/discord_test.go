@@ -0,0 +1,88 @@
+package discord
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pingBody = `{"id":"1","type":1,"application_id":"2","token":"t"}`
+
+func signedRequest(private ed25519.PrivateKey, at time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	signature := ed25519.Sign(private, []byte(timestamp+body))
+	request := httptest.NewRequest("POST", "/discord/interactions", strings.NewReader(body))
+	request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	request.Header.Set("X-Signature-Timestamp", timestamp)
+	return request
+}
+
+func TestVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Verify(signedRequest(private, time.Now(), pingBody), public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != pingBody {
+		t.Errorf("body %q", body)
+	}
+
+	otherPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := Verify(signedRequest(private, time.Now(), pingBody), otherPublic); err != ErrBadSignature {
+		t.Errorf("wrong key: got %v, want ErrBadSignature", err)
+	}
+
+	tampered := signedRequest(private, time.Now(), pingBody)
+	tampered.Body = httptest.NewRequest("POST", "/", strings.NewReader(`{"type":2}`)).Body
+	if _, err := Verify(tampered, public); err != ErrBadSignature {
+		t.Errorf("tampered body: got %v, want ErrBadSignature", err)
+	}
+
+	retimed := signedRequest(private, time.Now(), pingBody)
+	retimed.Header.Set("X-Signature-Timestamp", strconv.FormatInt(time.Now().Unix()-1, 10))
+	if _, err := Verify(retimed, public); err != ErrBadSignature {
+		t.Errorf("different timestamp: got %v, want ErrBadSignature", err)
+	}
+
+	for _, header := range []string{"", "zz", "00"} {
+		request := signedRequest(private, time.Now(), pingBody)
+		request.Header.Set("X-Signature-Ed25519", header)
+		if _, err := Verify(request, public); err != ErrBadSignature {
+			t.Errorf("signature %q: got %v, want ErrBadSignature", header, err)
+		}
+	}
+}
+
+func TestVerifyStale(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	for _, age := range []time.Duration{6 * time.Minute, -6 * time.Minute} {
+		if _, err := Verify(signedRequest(private, time.Now().Add(-age), pingBody), public); err != ErrStale {
+			t.Errorf("%v old: got %v, want ErrStale", age, err)
+		}
+	}
+	if _, err := Verify(signedRequest(private, time.Now().Add(-4*time.Minute), pingBody), public); err != nil {
+		t.Errorf("4m old: %v", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ParsePublicKey(hex.EncodeToString(public))
+	if err != nil || !key.Equal(public) {
+		t.Errorf("got %x, %v", key, err)
+	}
+	for _, bad := range []string{"", "not hex", "abcd"} {
+		if _, err := ParsePublicKey(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
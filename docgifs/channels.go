@@ -0,0 +1,126 @@
+package docgifs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var validChannelRE = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// reservedChannels are taken by other pages under /docgif/.
+var reservedChannels = map[string]bool{"history": true, "events": true, "poll": true}
+
+// Channel is one doc-gif page, watching its own account. Channels are
+// declared as a json list, like
+//
+//	[{"name": "doc", "account": "docdocdocbrown", "interval": "5s", "caption": "doc gif"}]
+type Channel struct {
+	Name     string   `json:"name"`
+	Account  string   `json:"account"`
+	Interval Duration `json:"interval,omitempty"`
+
+	// Caption comes before the search text. Defaults to the name and "gif".
+	Caption string `json:"caption,omitempty"`
+}
+
+// Duration is a time.Duration written like "5s" in json.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParseChannels reads a json list of channels. With none declared, there's
+// just the original: doc gifs from docdocdocbrown.
+func ParseChannels(s string) ([]Channel, error) {
+	if s == "" {
+		return []Channel{{Name: "doc", Account: "docdocdocbrown", Caption: "doc gif"}}, nil
+	}
+	var channels []Channel
+	if err := json.Unmarshal([]byte(s), &channels); err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("no channels")
+	}
+	seen := map[string]bool{}
+	for i, channel := range channels {
+		if !validChannelRE.MatchString(channel.Name) {
+			return nil, fmt.Errorf("channel names are lowercase letters, numbers, - and _, not %q", channel.Name)
+		}
+		if reservedChannels[channel.Name] {
+			return nil, fmt.Errorf("%q can't be a channel name, /docgif/%s is taken", channel.Name, channel.Name)
+		}
+		if seen[channel.Name] {
+			return nil, fmt.Errorf("channel %q is declared twice", channel.Name)
+		}
+		seen[channel.Name] = true
+		if channel.Account == "" {
+			return nil, fmt.Errorf("channel %q has no account", channel.Name)
+		}
+		if channel.Caption == "" {
+			channels[i].Caption = channel.Name + " gif"
+		}
+	}
+	return channels, nil
+}
+
+// Limiter is a token bucket: up to burst calls at once, refilling at one
+// call per every. Refreshers sharing one stay within a single api budget.
+type Limiter struct {
+	burst float64
+	every time.Duration
+	clock Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter allows n calls per period. clock may be nil for the real one.
+func NewLimiter(n int, period time.Duration, clock Clock) *Limiter {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Limiter{
+		burst:  float64(n),
+		every:  period / time.Duration(n),
+		clock:  clock,
+		tokens: float64(n),
+		last:   clock.Now(),
+	}
+}
+
+// Allow spends a call if there's one to spend.
+func (l *Limiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.every)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,27 @@
+package docgifs
+
+import "testing"
+
+func TestParseChannels(t *testing.T) {
+	channels, err := ParseChannels(`[{"name": "doc", "account": "docdocdocbrown"}, {"name": "marty", "account": "mcflymarty", "interval": "10s", "caption": "hello mcfly"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[0].Caption != "doc gif" || channels[1].Caption != "hello mcfly" {
+		t.Errorf("got %+v", channels)
+	}
+
+	for _, s := range []string{
+		`[]`,
+		`[{"name": "Doc", "account": "docdocdocbrown"}]`,
+		`[{"name": "doc"}]`,
+		`[{"name": "doc", "account": "a"}, {"name": "doc", "account": "b"}]`,
+		`[{"name": "history", "account": "docdocdocbrown"}]`,
+		`[{"name": "events", "account": "docdocdocbrown"}]`,
+		`[{"name": "poll", "account": "docdocdocbrown"}]`,
+	} {
+		if _, err := ParseChannels(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
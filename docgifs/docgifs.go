@@ -1,126 +1,329 @@
 package docgifs
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
-	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/kurrik/oauth1a"
-	"github.com/kurrik/twittergo"
+)
+
+// Can only hit the api 180 times / 15 mins (So about every 5 seconds)
+const (
+	RateLimit       = 180
+	RateLimitWindow = 15 * time.Minute
+	DefaultInterval = RateLimitWindow / RateLimit
 )
 
 var (
-	twitterConsumerKey       = os.Getenv("TWITTER_CONSUMER_KEY")
-	twitterConsumerSecret    = os.Getenv("TWITTER_CONSUMER_SECRET")
-	twitterAccessToken       = os.Getenv("TWITTER_ACCESS_TOKEN")
-	twitterAccessTokenSecret = os.Getenv("TWITTER_ACCESS_TOKEN_SECRET")
-
-	giphyURL   = "http://media4.giphy.com/media/14aUO0Mf7dWDXW/giphy.gif"
-	searchText = "oh no"
-	mu         sync.Mutex
+	// ErrRateLimited means a refresh was skipped to stay within the api budget.
+	ErrRateLimited = errors.New("skipped a refresh to stay within the rate limit")
+	// ErrNoCredentials means there's nothing to call twitter with.
+	ErrNoCredentials = errors.New("y u no set TWITTER_BEARER_TOKEN (or TWITTER_CONSUMER_* and TWITTER_ACCESS_TOKEN*)???")
 )
 
-type TemplatePage struct {
+// Config is everything a Refresher needs. Only the credentials are required.
+type Config struct {
+	// APIVersion is "2", or "1.1" for the legacy api. Left empty, it's
+	// whichever the credentials are for.
+	APIVersion string
+
+	// BearerToken is the app's token for version 2.
+	BearerToken string
+
+	// OAuth1 credentials for version 1.1.
+	ConsumerKey       string
+	ConsumerSecret    string
+	AccessToken       string
+	AccessTokenSecret string
+
+	// Account is the screen name whose tweets are watched. Defaults to
+	// docdocdocbrown.
+	Account string
+
+	// Channel names the Refresher in its History.
+	Channel string
+
+	// History, if set, records every doc gif shown, and where to pick up
+	// from after a restart.
+	History *History
+
+	// Caption comes before the search text on the page. Defaults to
+	// "doc gif".
+	Caption string
+
+	// Interval is how often to check for a new tweet. Defaults to
+	// DefaultInterval.
+	Interval time.Duration
+
+	// Limiter, if set, is the api budget to refresh within. Share one
+	// between Refreshers using the same credentials.
+	Limiter *Limiter
+
+	// TwitterBaseURL is where the version 2 api is. Defaults to
+	// https://api.twitter.com.
+	TwitterBaseURL string
+
+	// TwitterHost is where the version 1.1 api is, always over https.
+	// Defaults to api.twitter.com.
+	TwitterHost string
+
+	// HTTPClient talks to twitter and giphy. Defaults to one with a
+	// timeout.
+	HTTPClient *http.Client
+
+	// Clock tells the time. Defaults to the real one.
+	Clock Clock
+}
+
+// Clock is the time, swappable for a fake one.
+type Clock interface {
+	Now() time.Time
+	Tick(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                        { return time.Now() }
+func (realClock) Tick(d time.Duration) <-chan time.Time { return time.Tick(d) }
+
+// Snapshot is the latest doc gif. It's never modified once made.
+type Snapshot struct {
+	Caption    string
 	GiphyURL   string
 	SearchText string
+	TweetID    string
+	Permalink  string
+	Posted     time.Time
+
+	// Refreshed is when the tweet was first seen.
+	Refreshed time.Time
 }
 
-// Can only hit the api 180 times / 15 mins (So about every 5 seconds)
-func PeriodicallyRefresh() {
-	if err := refresh(); err != nil {
-		log.Println("ERROR:", "docgifs:", err.Error())
-	}
-	for range time.Tick(15 * time.Minute / 180) {
-		if err := refresh(); err != nil {
-			log.Println("ERROR:", "docgifs:", err.Error())
-		}
-	}
+// tweet is the little we need of one.
+type tweet struct {
+	ID     string
+	Posted time.Time
+
+	// Text is the search text, without the link.
+	Text string
+
+	// Link is the giphy page the tweet links to, and MediaURL an image
+	// attached to the tweet, for when there's no link.
+	Link     string
+	MediaURL string
 }
 
-func refresh() error {
-	config := &oauth1a.ClientConfig{
-		ConsumerKey:    twitterConsumerKey,
-		ConsumerSecret: twitterConsumerSecret,
+// Refresher keeps track of the latest gif tweeted by an account.
+type Refresher struct {
+	config   Config
+	timeline timeline
+	current  atomic.Value // Snapshot
+
+	mu          sync.Mutex
+	subscribers map[chan Snapshot]bool
+}
+
+// New makes a Refresher from config. Until its first refresh it has
+// something suitable to show.
+func New(config Config) (*Refresher, error) {
+	if config.Account == "" {
+		config.Account = "docdocdocbrown"
 	}
-	user := oauth1a.NewAuthorizedConfig(twitterAccessToken, twitterAccessTokenSecret)
-	client := twittergo.NewClient(config, user)
-	query := url.Values{
-		"screen_name": []string{"docdocdocbrown"},
-		"count":       []string{"1"},
+	if config.Caption == "" {
+		config.Caption = "doc gif"
 	}
-	url := fmt.Sprintf("/1.1/statuses/user_timeline.json?%v", query.Encode())
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
 	}
-	resp, err := client.SendRequest(req)
-	if err != nil {
-		return err
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if config.APIVersion == "" {
+		// Don't quietly pick an api there are no credentials for.
+		switch {
+		case config.BearerToken != "":
+			config.APIVersion = "2"
+		case config.ConsumerKey != "" && config.AccessToken != "":
+			config.APIVersion = "1.1"
+		default:
+			return nil, ErrNoCredentials
+		}
 	}
 
-	var statuses []map[string]interface{}
-	err = json.Unmarshal(body, &statuses)
-	if err != nil {
-		return err
+	var timeline timeline
+	switch config.APIVersion {
+	case "2":
+		if config.BearerToken == "" {
+			return nil, ErrNoCredentials
+		}
+		timeline = newV2Timeline(config)
+	case "1.1":
+		if config.ConsumerKey == "" || config.AccessToken == "" {
+			return nil, ErrNoCredentials
+		}
+		timeline = newLegacyTimeline(config)
+	default:
+		return nil, fmt.Errorf("unknown twitter api version %q", config.APIVersion)
 	}
 
-	if len(statuses) < 1 {
-		return errors.New("couldn't find any doc gifs")
+	r := &Refresher{config: config, timeline: timeline, subscribers: map[chan Snapshot]bool{}}
+	r.current.Store(Snapshot{
+		Caption:    config.Caption,
+		GiphyURL:   "https://media4.giphy.com/media/14aUO0Mf7dWDXW/giphy.gif",
+		SearchText: "oh no",
+	})
+	if config.History != nil {
+		if e, ok := config.History.At(config.Channel, config.Clock.Now()); ok {
+			r.current.Store(r.snapshot(e))
+		}
 	}
+	return r, nil
+}
 
-	text, ok := statuses[0]["text"].(string)
-	if !ok {
-		return errors.New("couldn't find any text in the tweet")
+// PeriodicallyRefresh refreshes now and then every interval, forever.
+func (r *Refresher) PeriodicallyRefresh() {
+	r.refresh()
+	for range r.config.Clock.Tick(r.config.Interval) {
+		r.refresh()
 	}
+}
 
-	lastWS := strings.LastIndex(text, " ")
-	if lastWS < 0 {
-		return errors.New("couldn't find any search text in the tweet")
+func (r *Refresher) refresh() {
+	// Running out of budget is expected with a few channels on the go.
+	if err := r.Refresh(); err != nil && err != ErrRateLimited {
+		log.Println("ERROR:", "docgifs:", r.config.Account+":", err.Error())
 	}
+}
 
-	fields := strings.Fields(text)
-	shortURL := fields[len(fields)-1]
+// Current returns the latest doc gif.
+func (r *Refresher) Current() Snapshot {
+	return r.current.Load().(Snapshot)
+}
 
-	req, err = http.NewRequest("GET", shortURL, nil)
-	if err != nil {
-		return err
+// Subscribe returns a channel that gets every new snapshot, and a function
+// to call when done with it. A slow subscriber only misses the snapshots it
+// was too slow for, never the latest.
+func (r *Refresher) Subscribe() (<-chan Snapshot, func()) {
+	updates := make(chan Snapshot, 1)
+	r.mu.Lock()
+	r.subscribers[updates] = true
+	r.mu.Unlock()
+	return updates, func() {
+		r.mu.Lock()
+		delete(r.subscribers, updates)
+		r.mu.Unlock()
 	}
+}
 
-	// Use jquery-like syntax to parse the giphy page for the direct gif url.
-	doc, err := goquery.NewDocument(shortURL)
+// publish makes snapshot current and tells subscribers about it.
+func (r *Refresher) publish(snapshot Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current.Store(snapshot)
+	for updates := range r.subscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- snapshot
+	}
+}
+
+// At returns what was showing at t, if there's history that far back.
+func (r *Refresher) At(t time.Time) (Snapshot, bool) {
+	if r.config.History == nil {
+		return Snapshot{}, false
+	}
+	e, ok := r.config.History.At(r.config.Channel, t)
+	if !ok {
+		return Snapshot{}, false
+	}
+	return r.snapshot(e), true
+}
+
+// Refresh looks up the account's latest tweet and the gif it links to. The
+// current snapshot only changes if that all works out.
+func (r *Refresher) Refresh() error {
+	if r.config.Limiter != nil && !r.config.Limiter.Allow() {
+		return ErrRateLimited
+	}
+	latest, err := r.timeline.latest(r.config.Account)
 	if err != nil {
 		return err
 	}
+	if latest.ID != "" && latest.ID == r.Current().TweetID {
+		// Nothing new.
+		return nil
+	}
+	if latest.Text == "" {
+		return errors.New("couldn't find any search text in the tweet")
+	}
 
-	mu.Lock()
-	defer mu.Unlock()
-	giphyURL, ok = doc.Find("meta[property='og:image']").Attr("content")
-	if !ok {
-		return errors.New("couldn't locate giphy url")
+	giphyURL := latest.MediaURL
+	if latest.Link != "" {
+		if giphyURL, err = r.resolve(latest.Link); err != nil {
+			return err
+		}
+	}
+	if giphyURL == "" {
+		return errors.New("couldn't find a gif in the tweet")
 	}
-	searchText = strings.Join(fields[:len(fields)-1], " ")
 
+	entry := Entry{
+		Channel:    r.config.Channel,
+		TweetID:    latest.ID,
+		Permalink:  "https://twitter.com/" + r.config.Account + "/status/" + latest.ID,
+		Posted:     latest.Posted,
+		SearchText: latest.Text,
+		MediaURL:   giphyURL,
+		Shown:      r.config.Clock.Now(),
+	}
+	r.publish(r.snapshot(entry))
+	if r.config.History != nil {
+		return r.config.History.Record(entry)
+	}
 	return nil
 }
 
-func CurrentPage() TemplatePage {
-	return TemplatePage{
-		GiphyURL:   giphyURL,
-		SearchText: searchText,
+// snapshot returns what the Refresher would have shown for a history entry.
+func (r *Refresher) snapshot(e Entry) Snapshot {
+	return Snapshot{
+		Caption:    r.config.Caption,
+		GiphyURL:   e.MediaURL,
+		SearchText: e.SearchText,
+		TweetID:    e.TweetID,
+		Permalink:  e.Permalink,
+		Posted:     e.Posted,
+		Refreshed:  e.Shown,
+	}
+}
+
+// resolve follows a tweeted link to its giphy page and returns the direct gif
+// url.
+func (r *Refresher) resolve(shortURL string) (string, error) {
+	resp, err := r.config.HTTPClient.Get(shortURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Use jquery-like syntax to parse the giphy page for the direct gif url.
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	giphyURL, ok := doc.Find("meta[property='og:image']").Attr("content")
+	if !ok {
+		return "", errors.New("couldn't locate giphy url")
 	}
+	return giphyURL, nil
 }
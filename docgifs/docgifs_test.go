@@ -0,0 +1,126 @@
+package docgifs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// twoAccounts has the stand-in answer for doc and marty, each linking to a
+// giphy page of their own.
+func twoAccounts(standIn *twitterStandIn, server *httptest.Server) {
+	replies := v2Replies(server.URL)
+	replies["/2/users/by/username/mcflymarty"] = `{"data": {"id": "5678"}}`
+	replies["/2/users/5678/tweets"] = strings.Replace(
+		strings.Replace(replies["/2/users/1234/tweets"], "great scott", "hello mcfly", 1),
+		"1500000000000000001", "1500000000000000002", 1)
+	standIn.replies = replies
+}
+
+func newChannel(t *testing.T, server *httptest.Server, account string, limiter *Limiter) *Refresher {
+	r, err := New(Config{
+		BearerToken:    "AAAAbearer",
+		TwitterBaseURL: server.URL,
+		HTTPClient:     server.Client(),
+		Account:        account,
+		Channel:        account,
+		Limiter:        limiter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRefreshersSideBySide(t *testing.T) {
+	standIn := newTwitterStandIn(nil)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	twoAccounts(standIn, server)
+
+	limiter := NewLimiter(RateLimit, RateLimitWindow, nil)
+	doc := newChannel(t, server, "docdocdocbrown", limiter)
+	marty := newChannel(t, server, "mcflymarty", limiter)
+
+	updates, done := doc.Subscribe()
+	defer done()
+
+	// Refresh both at once while readers look on.
+	var wg sync.WaitGroup
+	for _, r := range []*Refresher{doc, marty, doc, marty} {
+		wg.Add(2)
+		go func(r *Refresher) {
+			defer wg.Done()
+			if err := r.Refresh(); err != nil {
+				t.Error(err)
+			}
+		}(r)
+		go func(r *Refresher) {
+			defer wg.Done()
+			r.Current()
+		}(r)
+	}
+	wg.Wait()
+
+	if got := doc.Current(); got.SearchText != "great scott" || got.TweetID != "1500000000000000001" {
+		t.Errorf("doc: got %+v", got)
+	}
+	if got := marty.Current(); got.SearchText != "hello mcfly" || got.TweetID != "1500000000000000002" {
+		t.Errorf("marty: got %+v", got)
+	}
+	select {
+	case snapshot := <-updates:
+		if snapshot.SearchText != "great scott" {
+			t.Errorf("doc's subscriber got %+v", snapshot)
+		}
+	default:
+		t.Error("doc's subscriber heard nothing")
+	}
+}
+
+func TestRefreshFailureKeepsCurrent(t *testing.T) {
+	standIn := newTwitterStandIn(nil)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	twoAccounts(standIn, server)
+
+	doc := newChannel(t, server, "docdocdocbrown", nil)
+	marty := newChannel(t, server, "mcflymarty", nil)
+	initial := marty.Current()
+	if err := doc.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	before := doc.Current()
+
+	// A newer tweet, but twitter's having a bad day.
+	standIn.mu.Lock()
+	standIn.replies["/2/users/1234/tweets"] = strings.Replace(standIn.replies["/2/users/1234/tweets"], "1500000000000000001", "1500000000000000003", 1)
+	standIn.status = http.StatusServiceUnavailable
+	standIn.mu.Unlock()
+	if err := doc.Refresh(); err == nil {
+		t.Error("expected an error")
+	}
+	if err := marty.Refresh(); err == nil {
+		t.Error("expected an error")
+	}
+	if got := doc.Current(); got != before {
+		t.Errorf("doc changed on a failed refresh: %+v", got)
+	}
+	if got := marty.Current(); got != initial {
+		t.Errorf("marty changed on a failed refresh: %+v", got)
+	}
+
+	// Twitter's fine, but the link goes nowhere useful.
+	standIn.mu.Lock()
+	standIn.status = http.StatusOK
+	standIn.replies["/2/users/1234/tweets"] = strings.Replace(standIn.replies["/2/users/1234/tweets"], "/gifs/sheep", "/gifs/missing", 1)
+	standIn.mu.Unlock()
+	if err := doc.Refresh(); err == nil {
+		t.Error("expected an error")
+	}
+	if got := doc.Current(); got != before {
+		t.Errorf("doc changed on a failed refresh: %+v", got)
+	}
+}
@@ -0,0 +1,145 @@
+package docgifs
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/store"
+)
+
+// Entry is one doc gif as it was shown.
+type Entry struct {
+	Channel    string    `json:"channel"`
+	TweetID    string    `json:"tweet_id"`
+	Permalink  string    `json:"permalink"`
+	Posted     time.Time `json:"posted"`
+	SearchText string    `json:"search_text"`
+	MediaURL   string    `json:"media_url"`
+
+	// Shown is when we started showing it, which may be a while after it
+	// was posted.
+	Shown time.Time `json:"shown"`
+}
+
+// Stat counts how many times a gif has been posted.
+type Stat struct {
+	MediaURL string `json:"media_url"`
+	Count    int    `json:"count"`
+	Latest   Entry  `json:"latest"`
+}
+
+// History remembers every doc gif shown, oldest first, saving to a json file
+// as it goes. It keeps the size most recent.
+type History struct {
+	path string
+	size int
+
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// NewHistory loads any history saved at path.
+func NewHistory(path string, size int) (*History, error) {
+	h := &History{path: path, size: size}
+	if err := store.Load(path, &h.entries); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record adds entry, unless it's the tweet its channel is already showing.
+func (h *History) Record(entry Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if h.entries[i].Channel == entry.Channel {
+			if h.entries[i].TweetID == entry.TweetID {
+				return nil
+			}
+			break
+		}
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.size {
+		h.entries = append([]Entry(nil), h.entries[len(h.entries)-h.size:]...)
+	}
+	return store.Save(h.path, h.entries)
+}
+
+// At returns what channel was showing at t.
+func (h *History) At(channel string, t time.Time) (Entry, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		if e := h.entries[i]; e.Channel == channel && !e.Shown.After(t) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Search returns a page of channel's entries whose search text contains
+// query, newest first, and how many there are in all. An empty channel means
+// every channel.
+func (h *History) Search(channel, query string, offset, limit int) ([]Entry, int) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var matches []Entry
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		if channel != "" && e.Channel != channel {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(e.SearchText), query) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	total := len(matches)
+	if offset >= total {
+		return nil, total
+	}
+	matches = matches[offset:]
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, total
+}
+
+// Top returns the n gifs posted most often on channel, or every channel if
+// it's empty.
+func (h *History) Top(channel string, n int) []Stat {
+	h.mu.RLock()
+	byURL := map[string]*Stat{}
+	for _, e := range h.entries {
+		if channel != "" && e.Channel != channel {
+			continue
+		}
+		stat, ok := byURL[e.MediaURL]
+		if !ok {
+			stat = &Stat{MediaURL: e.MediaURL}
+			byURL[e.MediaURL] = stat
+		}
+		stat.Count++
+		stat.Latest = e
+	}
+	h.mu.RUnlock()
+
+	stats := make([]Stat, 0, len(byURL))
+	for _, stat := range byURL {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Latest.Shown.After(stats[j].Latest.Shown)
+	})
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
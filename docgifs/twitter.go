@@ -0,0 +1,268 @@
+package docgifs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kurrik/oauth1a"
+	"github.com/kurrik/twittergo"
+)
+
+// timeline finds an account's latest tweet.
+type timeline interface {
+	latest(account string) (tweet, error)
+}
+
+// legacyTimeline reads the retired /1.1/statuses/user_timeline.json with
+// OAuth1 user credentials.
+type legacyTimeline struct {
+	client *twittergo.Client
+}
+
+func newLegacyTimeline(config Config) *legacyTimeline {
+	client := twittergo.NewClient(
+		&oauth1a.ClientConfig{
+			ConsumerKey:    config.ConsumerKey,
+			ConsumerSecret: config.ConsumerSecret,
+		},
+		oauth1a.NewAuthorizedConfig(config.AccessToken, config.AccessTokenSecret),
+	)
+	client.HttpClient = config.HTTPClient
+	if config.TwitterHost != "" {
+		client.Host = config.TwitterHost
+	}
+	return &legacyTimeline{client: client}
+}
+
+func (t *legacyTimeline) latest(account string) (tweet, error) {
+	query := url.Values{
+		"screen_name": []string{account},
+		"count":       []string{"1"},
+	}
+	req, err := http.NewRequest("GET", fmt.Sprintf("/1.1/statuses/user_timeline.json?%v", query.Encode()), nil)
+	if err != nil {
+		return tweet{}, err
+	}
+	resp, err := t.client.SendRequest(req)
+	if err != nil {
+		return tweet{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return tweet{}, err
+	}
+
+	var statuses []map[string]interface{}
+	if err := json.Unmarshal(body, &statuses); err != nil {
+		return tweet{}, err
+	}
+	if len(statuses) < 1 {
+		return tweet{}, errors.New("couldn't find any doc gifs")
+	}
+	text, ok := statuses[0]["text"].(string)
+	if !ok {
+		return tweet{}, errors.New("couldn't find any text in the tweet")
+	}
+	id, _ := statuses[0]["id_str"].(string)
+	createdAt, _ := statuses[0]["created_at"].(string)
+	posted, _ := time.Parse(time.RubyDate, createdAt)
+
+	// The link is the last thing in the tweet.
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return tweet{}, errors.New("couldn't find any search text in the tweet")
+	}
+	return tweet{
+		ID:     id,
+		Posted: posted,
+		Text:   strings.Join(fields[:len(fields)-1], " "),
+		Link:   fields[len(fields)-1],
+	}, nil
+}
+
+// v2Timeline reads /2/users/:id/tweets with an app bearer token.
+type v2Timeline struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	userIDs map[string]string // by username
+}
+
+func newV2Timeline(config Config) *v2Timeline {
+	baseURL := config.TwitterBaseURL
+	if baseURL == "" {
+		baseURL = "https://api.twitter.com"
+	}
+	return &v2Timeline{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      config.BearerToken,
+		httpClient: config.HTTPClient,
+		userIDs:    map[string]string{},
+	}
+}
+
+type v2Error struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+type v2User struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	Errors []v2Error `json:"errors"`
+}
+
+type v2Tweets struct {
+	Data []struct {
+		ID        string    `json:"id"`
+		Text      string    `json:"text"`
+		CreatedAt time.Time `json:"created_at"`
+		Entities  struct {
+			URLs []struct {
+				URL         string `json:"url"`
+				ExpandedURL string `json:"expanded_url"`
+				UnwoundURL  string `json:"unwound_url"`
+				MediaKey    string `json:"media_key"`
+			} `json:"urls"`
+		} `json:"entities"`
+		Attachments struct {
+			MediaKeys []string `json:"media_keys"`
+		} `json:"attachments"`
+	} `json:"data"`
+	Includes struct {
+		Media []v2Media `json:"media"`
+	} `json:"includes"`
+	Errors []v2Error `json:"errors"`
+}
+
+type v2Media struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url"`
+	PreviewImageURL string `json:"preview_image_url"`
+}
+
+// imageURL is something an img can show for the media. Photos have a url;
+// gifs and videos only come as mp4s, so they get their preview image.
+func (m v2Media) imageURL() string {
+	if m.Type == "photo" && m.URL != "" {
+		return m.URL
+	}
+	return m.PreviewImageURL
+}
+
+func (t *v2Timeline) latest(account string) (tweet, error) {
+	userID, err := t.userID(account)
+	if err != nil {
+		return tweet{}, err
+	}
+
+	query := url.Values{
+		// 5 is the least it'll give.
+		"max_results":  []string{"5"},
+		"exclude":      []string{"retweets,replies"},
+		"expansions":   []string{"attachments.media_keys"},
+		"tweet.fields": []string{"created_at,entities"},
+		"media.fields": []string{"type,url,preview_image_url"},
+	}
+	var tweets v2Tweets
+	if err := t.get("/2/users/"+url.PathEscape(userID)+"/tweets?"+query.Encode(), &tweets); err != nil {
+		return tweet{}, err
+	}
+	if len(tweets.Errors) > 0 {
+		return tweet{}, fmt.Errorf("twitter: %s: %s", tweets.Errors[0].Title, tweets.Errors[0].Detail)
+	}
+	if len(tweets.Data) < 1 {
+		return tweet{}, errors.New("couldn't find any doc gifs")
+	}
+	data := tweets.Data[0]
+
+	latest := tweet{ID: data.ID, Posted: data.CreatedAt, Text: data.Text}
+	for _, u := range data.Entities.URLs {
+		// Links are t.co'd in the text; the entities say where they go.
+		// Attached media gets a link too, and is dealt with below.
+		latest.Text = strings.Replace(latest.Text, u.URL, "", -1)
+		if u.MediaKey != "" {
+			continue
+		}
+		latest.Link = u.UnwoundURL
+		if latest.Link == "" {
+			latest.Link = u.ExpandedURL
+		}
+	}
+	latest.Text = strings.Join(strings.Fields(latest.Text), " ")
+
+	// Without a link, what's attached to the tweet will do.
+	if latest.Link == "" {
+		for _, key := range data.Attachments.MediaKeys {
+			for _, media := range tweets.Includes.Media {
+				if media.MediaKey == key && latest.MediaURL == "" {
+					latest.MediaURL = media.imageURL()
+				}
+			}
+		}
+	}
+	return latest, nil
+}
+
+// userID looks up an account's id, which the timeline is addressed by. It
+// never changes, so it's only looked up once.
+func (t *v2Timeline) userID(account string) (string, error) {
+	t.mu.Lock()
+	id, ok := t.userIDs[account]
+	t.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var user v2User
+	if err := t.get("/2/users/by/username/"+url.PathEscape(account), &user); err != nil {
+		return "", err
+	}
+	if len(user.Errors) > 0 {
+		return "", fmt.Errorf("twitter: %s: %s", user.Errors[0].Title, user.Errors[0].Detail)
+	}
+	if user.Data.ID == "" {
+		return "", fmt.Errorf("twitter: no such account %q", account)
+	}
+
+	t.mu.Lock()
+	t.userIDs[account] = user.Data.ID
+	t.mu.Unlock()
+	return user.Data.ID, nil
+}
+
+// get decodes the json at path into v.
+func (t *v2Timeline) get(path string, v interface{}) error {
+	req, err := http.NewRequest("GET", t.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("twitter: %s responded %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
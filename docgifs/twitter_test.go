@@ -0,0 +1,312 @@
+package docgifs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// twitterStandIn answers like the twitter api and giphy do, and keeps count
+// of what was asked of it.
+type twitterStandIn struct {
+	mu       sync.Mutex
+	requests map[string]int
+	auth     []string
+
+	// Replies by path. The giphy page is always at /gifs/sheep.
+	replies map[string]string
+	status  int
+}
+
+func newTwitterStandIn(replies map[string]string) *twitterStandIn {
+	return &twitterStandIn{requests: map[string]int{}, replies: replies, status: http.StatusOK}
+}
+
+const giphyPage = `<html><head>
+<meta property="og:image" content="https://media.giphy.com/media/abc/giphy.gif">
+</head><body></body></html>`
+
+func (s *twitterStandIn) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s.mu.Lock()
+	s.requests[request.URL.Path]++
+	s.auth = append(s.auth, request.Header.Get("Authorization"))
+	reply, ok := s.replies[request.URL.Path]
+	status := s.status
+	s.mu.Unlock()
+
+	if request.URL.Path == "/gifs/sheep" {
+		response.Write([]byte(giphyPage))
+		return
+	}
+	if !ok {
+		http.NotFound(response, request)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	response.Write([]byte(reply))
+}
+
+func (s *twitterStandIn) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// v2Replies are a user and a tweet linking to the stand-in's giphy page,
+// through t.co like twitter does.
+func v2Replies(giphyBase string) map[string]string {
+	return map[string]string{
+		"/2/users/by/username/docdocdocbrown": `{"data": {"id": "1234", "name": "Doc", "username": "docdocdocbrown"}}`,
+		"/2/users/1234/tweets": `{
+  "data": [{
+    "id": "1500000000000000001",
+    "text": "great scott https://t.co/AbCdEf https://t.co/PiCtUrE",
+    "created_at": "2026-10-17T07:00:00.000Z",
+    "entities": {"urls": [
+      {"start": 12, "end": 35, "url": "https://t.co/AbCdEf", "expanded_url": "https://gph.is/sheep", "unwound_url": "` + giphyBase + `/gifs/sheep"},
+      {"start": 36, "end": 59, "url": "https://t.co/PiCtUrE", "expanded_url": "https://twitter.com/docdocdocbrown/status/1500000000000000001/photo/1", "media_key": "16_1500"}
+    ]}
+  }],
+  "meta": {"result_count": 1}
+}`,
+	}
+}
+
+func newV2Refresher(t *testing.T, server *httptest.Server) *Refresher {
+	r, err := New(Config{
+		BearerToken:    "AAAAbearer",
+		TwitterBaseURL: server.URL,
+		HTTPClient:     server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestV2Timeline(t *testing.T) {
+	standIn := newTwitterStandIn(nil)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	standIn.replies = v2Replies(server.URL)
+
+	r := newV2Refresher(t, server)
+	latest, err := r.timeline.latest("docdocdocbrown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != "1500000000000000001" || latest.Posted.IsZero() {
+		t.Errorf("got %+v", latest)
+	}
+	if latest.Text != "great scott" {
+		t.Errorf("text %q, want the t.co links stripped", latest.Text)
+	}
+	if latest.Link != server.URL+"/gifs/sheep" {
+		t.Errorf("link %q, want the unwound url", latest.Link)
+	}
+
+	for _, auth := range standIn.auth {
+		if auth != "Bearer AAAAbearer" {
+			t.Errorf("authorization %q", auth)
+		}
+	}
+}
+
+func TestV2TimelineCachesUserID(t *testing.T) {
+	standIn := newTwitterStandIn(nil)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	standIn.replies = v2Replies(server.URL)
+
+	r := newV2Refresher(t, server)
+	for i := 0; i < 3; i++ {
+		if _, err := r.timeline.latest("docdocdocbrown"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := standIn.count("/2/users/by/username/docdocdocbrown"); n != 1 {
+		t.Errorf("looked up the user %d times, want 1", n)
+	}
+	if n := standIn.count("/2/users/1234/tweets"); n != 3 {
+		t.Errorf("read the timeline %d times, want 3", n)
+	}
+}
+
+func TestV2TimelineErrors(t *testing.T) {
+	standIn := newTwitterStandIn(map[string]string{
+		"/2/users/by/username/docdocdocbrown": `{"data": {"id": "1234"}}`,
+		"/2/users/1234/tweets":                `{"errors": [{"title": "Forbidden", "detail": "Sorry, you are not authorized to see the status."}]}`,
+		"/2/users/by/username/nobody":         `{"errors": [{"title": "Not Found Error", "detail": "Could not find user with username: [nobody]."}]}`,
+	})
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	r := newV2Refresher(t, server)
+	_, err := r.timeline.latest("docdocdocbrown")
+	if err == nil || !strings.Contains(err.Error(), "Forbidden") {
+		t.Errorf("tweets errors: got %v", err)
+	}
+	_, err = r.timeline.latest("nobody")
+	if err == nil || !strings.Contains(err.Error(), "Could not find user") {
+		t.Errorf("user errors: got %v", err)
+	}
+	if _, ok := r.timeline.(*v2Timeline).userIDs["nobody"]; ok {
+		t.Error("cached a user that doesn't exist")
+	}
+
+	standIn.mu.Lock()
+	standIn.status = http.StatusTooManyRequests
+	standIn.mu.Unlock()
+	if _, err := r.timeline.latest("docdocdocbrown"); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("429: got %v", err)
+	}
+}
+
+func TestV2Refresh(t *testing.T) {
+	standIn := newTwitterStandIn(nil)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	standIn.replies = v2Replies(server.URL)
+
+	r := newV2Refresher(t, server)
+	if err := r.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	current := r.Current()
+	if current.GiphyURL != "https://media.giphy.com/media/abc/giphy.gif" || current.SearchText != "great scott" {
+		t.Errorf("got %+v", current)
+	}
+	if current.Permalink != "https://twitter.com/docdocdocbrown/status/1500000000000000001" {
+		t.Errorf("permalink %q", current.Permalink)
+	}
+}
+
+func TestLegacyTimeline(t *testing.T) {
+	standIn := newTwitterStandIn(map[string]string{
+		"/1.1/statuses/user_timeline.json": `[{
+  "id_str": "1500000000000000001",
+  "created_at": "Sat Oct 17 07:00:00 +0000 2026",
+  "text": "great scott https://t.co/AbCdEf"
+}]`,
+	})
+	server := httptest.NewTLSServer(standIn)
+	defer server.Close()
+
+	r, err := New(Config{
+		ConsumerKey:       "key",
+		ConsumerSecret:    "secret",
+		AccessToken:       "token",
+		AccessTokenSecret: "token secret",
+		TwitterHost:       strings.TrimPrefix(server.URL, "https://"),
+		HTTPClient:        server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.timeline.(*legacyTimeline); !ok {
+		t.Fatalf("with only OAuth1 credentials, got a %T", r.timeline)
+	}
+
+	latest, err := r.timeline.latest("docdocdocbrown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != "1500000000000000001" || latest.Text != "great scott" || latest.Link != "https://t.co/AbCdEf" {
+		t.Errorf("got %+v", latest)
+	}
+	if latest.Posted.IsZero() {
+		t.Error("no posted time")
+	}
+	if len(standIn.auth) != 1 || !strings.HasPrefix(standIn.auth[0], "OAuth ") {
+		t.Errorf("authorization %q", standIn.auth)
+	}
+}
+
+func TestNewAPIVersion(t *testing.T) {
+	oauth1 := Config{ConsumerKey: "key", ConsumerSecret: "secret", AccessToken: "token", AccessTokenSecret: "token secret"}
+	both := oauth1
+	both.BearerToken = "AAAAbearer"
+	bearerless := oauth1
+	bearerless.APIVersion = "2"
+
+	for _, test := range []struct {
+		name   string
+		config Config
+		want   string // the timeline's type, or "" for an error
+	}{
+		{"bearer", Config{BearerToken: "AAAAbearer"}, "*docgifs.v2Timeline"},
+		{"oauth1", oauth1, "*docgifs.legacyTimeline"},
+		{"both", both, "*docgifs.v2Timeline"},
+		{"neither", Config{}, ""},
+		{"2 without a bearer", bearerless, ""},
+		{"1.1 without OAuth1", Config{APIVersion: "1.1", BearerToken: "AAAAbearer"}, ""},
+		{"unknown", Config{APIVersion: "3", BearerToken: "AAAAbearer"}, ""},
+	} {
+		r, err := New(test.config)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", r.timeline); got != test.want {
+			t.Errorf("%s: got a %s, want a %s", test.name, got, test.want)
+		}
+	}
+
+	// The server carries on without doc gifs when it gets this.
+	if _, err := New(Config{}); err != ErrNoCredentials {
+		t.Errorf("no credentials: got %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestV2TimelineAttachedMedia(t *testing.T) {
+	for _, test := range []struct {
+		media string
+		want  string
+	}{
+		{`{"media_key": "3_1500", "type": "photo", "url": "https://pbs.twimg.com/media/sheep.jpg"}`, "https://pbs.twimg.com/media/sheep.jpg"},
+		{`{"media_key": "3_1500", "type": "animated_gif", "preview_image_url": "https://pbs.twimg.com/tweet_video_thumb/sheep.jpg"}`, "https://pbs.twimg.com/tweet_video_thumb/sheep.jpg"},
+	} {
+		standIn := newTwitterStandIn(map[string]string{
+			"/2/users/by/username/docdocdocbrown": `{"data": {"id": "1234"}}`,
+			"/2/users/1234/tweets": `{
+  "data": [{
+    "id": "1500000000000000001",
+    "text": "great scott https://t.co/PiCtUrE",
+    "created_at": "2026-10-17T07:00:00.000Z",
+    "entities": {"urls": [{"url": "https://t.co/PiCtUrE", "expanded_url": "https://twitter.com/docdocdocbrown/status/1500000000000000001/photo/1", "media_key": "3_1500"}]},
+    "attachments": {"media_keys": ["3_1500"]}
+  }],
+  "includes": {"media": [` + test.media + `]}
+}`,
+		})
+		var query string
+		server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			if strings.HasSuffix(request.URL.Path, "/tweets") {
+				query = request.URL.RawQuery
+			}
+			standIn.ServeHTTP(response, request)
+		}))
+
+		r := newV2Refresher(t, server)
+		if err := r.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Current(); got.GiphyURL != test.want || got.SearchText != "great scott" {
+			t.Errorf("got %+v, want %s", got, test.want)
+		}
+		if !strings.Contains(query, "expansions=attachments.media_keys") || !strings.Contains(query, "media.fields=") {
+			t.Errorf("didn't ask for the media: %s", query)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,137 @@
+package gifs
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kevin-cantwell/kvn/store"
+)
+
+// Ref points at one provider's gif.
+type Ref struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+}
+
+// Alias pins a query to specific gifs.
+type Alias struct {
+	Query string `json:"query"`
+	Gifs  []Ref  `json:"gifs"`
+}
+
+// Aliases is a Provider that answers pinned queries with their pinned gifs,
+// and passes everything else through. Pinned gifs are looked up with the
+// provider's Getter, so it should support one. Aliases are saved to a json
+// file whenever they change.
+type Aliases struct {
+	Provider
+	path string
+
+	mu      sync.RWMutex
+	aliases map[string][]Ref
+}
+
+// NewAliases loads any aliases saved at path.
+func NewAliases(provider Provider, path string) (*Aliases, error) {
+	a := &Aliases{Provider: provider, path: path, aliases: map[string][]Ref{}}
+	if err := store.Load(path, &a.aliases); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Aliases) Search(query string, opts Options) ([]Gif, error) {
+	a.mu.RLock()
+	refs, ok := a.aliases[Normalize(query)]
+	a.mu.RUnlock()
+	if !ok {
+		return a.Provider.Search(query, opts)
+	}
+	if opts.Offset > 0 {
+		// Aliases are a single page.
+		return nil, ErrNoResults
+	}
+
+	getter, ok := a.Provider.(Getter)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	var results []Gif
+	var firstErr error
+	for _, ref := range refs {
+		gif, err := getter.Get(ref.Provider, ref.ID, opts)
+		if err != nil {
+			if firstErr == nil && err != ErrNoResults {
+				firstErr = err
+			}
+			continue
+		}
+		results = append(results, gif)
+	}
+	if len(results) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrNoResults
+	}
+	return results, nil
+}
+
+func (a *Aliases) Trending(opts Options) ([]Gif, error) {
+	if trender, ok := a.Provider.(Trender); ok {
+		return trender.Trending(opts)
+	}
+	return nil, ErrUnsupported
+}
+
+func (a *Aliases) Random(tag string, opts Options) (Gif, error) {
+	if randomizer, ok := a.Provider.(Randomizer); ok {
+		return randomizer.Random(tag, opts)
+	}
+	return Gif{}, ErrUnsupported
+}
+
+func (a *Aliases) Get(provider, id string, opts Options) (Gif, error) {
+	if getter, ok := a.Provider.(Getter); ok {
+		return getter.Get(provider, id, opts)
+	}
+	return Gif{}, ErrUnsupported
+}
+
+// List returns every alias, sorted by query.
+func (a *Aliases) List() []Alias {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	list := make([]Alias, 0, len(a.aliases))
+	for query, refs := range a.aliases {
+		list = append(list, Alias{Query: query, Gifs: refs})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Query < list[j].Query })
+	return list
+}
+
+// Alias returns the gifs pinned to query.
+func (a *Aliases) Alias(query string) (Alias, bool) {
+	query = Normalize(query)
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	refs, ok := a.aliases[query]
+	return Alias{Query: query, Gifs: refs}, ok
+}
+
+// Set pins gifs to query, replacing whatever was pinned.
+func (a *Aliases) Set(query string, refs []Ref) (Alias, error) {
+	query = Normalize(query)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aliases[query] = refs
+	return Alias{Query: query, Gifs: refs}, store.Save(a.path, a.aliases)
+}
+
+// Delete unpins query.
+func (a *Aliases) Delete(query string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.aliases, Normalize(query))
+	return store.Save(a.path, a.aliases)
+}
@@ -0,0 +1,233 @@
+package gifs
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How long past its ttl an entry may still be served while it's refreshed in
+// the background, or indefinitely if the upstream is failing.
+const maxStale = time.Hour
+
+// Normalize folds case and whitespace so that equivalent queries share
+// cache entries.
+func Normalize(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// CacheStats counts how searches were answered.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Stale   uint64 `json:"stale"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// Cache is a Provider that remembers another provider's results. It holds at
+// most size entries, evicting the least recently used. Concurrent searches
+// for the same query share a single upstream call.
+type Cache struct {
+	provider Provider
+	size     int
+	ttl      time.Duration
+	now      func() time.Time // swappable for tests
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	inflight map[string]*cacheCall
+
+	hits, stale, misses uint64
+}
+
+type cacheEntry struct {
+	key     string
+	text    string
+	results []Gif
+	fetched time.Time
+}
+
+type cacheCall struct {
+	done    chan struct{}
+	results []Gif
+	err     error
+}
+
+func NewCache(provider Provider, size int, ttl time.Duration) *Cache {
+	return &Cache{
+		provider: provider,
+		size:     size,
+		ttl:      ttl,
+		now:      time.Now,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*cacheCall{},
+	}
+}
+
+func (c *Cache) Name() string {
+	return c.provider.Name()
+}
+
+func (c *Cache) Search(query string, opts Options) ([]Gif, error) {
+	return c.get(fmt.Sprintf("%s|%+v", Normalize(query), opts), query, func() ([]Gif, error) {
+		return c.provider.Search(query, opts)
+	})
+}
+
+// Trending caches the provider's trending gifs, if it has any.
+func (c *Cache) Trending(opts Options) ([]Gif, error) {
+	trender, ok := c.provider.(Trender)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return c.get(fmt.Sprintf("trending|%+v", opts), "trending", func() ([]Gif, error) {
+		return trender.Trending(opts)
+	})
+}
+
+// Random isn't cached, since that would make it rather less random.
+func (c *Cache) Random(tag string, opts Options) (Gif, error) {
+	randomizer, ok := c.provider.(Randomizer)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	return randomizer.Random(tag, opts)
+}
+
+// Get caches lookups by id, since permalinks get unfurled over and over.
+func (c *Cache) Get(provider, id string, opts Options) (Gif, error) {
+	getter, ok := c.provider.(Getter)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	results, err := c.get(fmt.Sprintf("gif|%s|%s|%+v", provider, id, opts), "", func() ([]Gif, error) {
+		gif, err := getter.Get(provider, id, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []Gif{gif}, nil
+	})
+	if err != nil {
+		return Gif{}, err
+	}
+	return results[0], nil
+}
+
+// get returns key's results, fetching them if they're missing or stale. text
+// is what the results were found by, for Documents.
+func (c *Cache) get(key, text string, fetch func() ([]Gif, error)) ([]Gif, error) {
+	c.mu.Lock()
+	var entry *cacheEntry
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		entry = el.Value.(*cacheEntry)
+		age := c.now().Sub(entry.fetched)
+		if age < c.ttl {
+			c.mu.Unlock()
+			atomic.AddUint64(&c.hits, 1)
+			return copyGifs(entry.results), nil
+		}
+		if age < c.ttl+maxStale {
+			call := c.call(key, text, fetch)
+			c.mu.Unlock()
+			atomic.AddUint64(&c.stale, 1)
+			go func() {
+				<-call.done
+				if call.err != nil {
+					log.Println("ERROR:", "gifs: revalidate:", call.err.Error())
+				}
+			}()
+			return copyGifs(entry.results), nil
+		}
+	}
+	call := c.call(key, text, fetch)
+	c.mu.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	<-call.done
+	if call.err != nil && call.err != ErrNoResults && entry != nil {
+		log.Println("ERROR:", "gifs: serving stale results:", call.err.Error())
+		atomic.AddUint64(&c.stale, 1)
+		return copyGifs(entry.results), nil
+	}
+	return copyGifs(call.results), call.err
+}
+
+// call returns the in-flight upstream fetch for key, starting one if needed.
+// c.mu must be held.
+func (c *Cache) call(key, text string, fetch func() ([]Gif, error)) *cacheCall {
+	if call, ok := c.inflight[key]; ok {
+		return call
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	go func() {
+		call.results, call.err = fetch()
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.store(key, text, call.results)
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// store adds or replaces an entry, evicting the oldest if over size.
+// c.mu must be held.
+func (c *Cache) store(key, text string, results []Gif) {
+	entry := &cacheEntry{key: key, text: text, results: results, fetched: c.now()}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Stale:   atomic.LoadUint64(&c.stale),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// Documents returns every cached gif, findable by the queries that found it.
+// Expired entries are included; they're still a fine answer when offline.
+func (c *Cache) Documents() []Document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var docs []Document
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cacheEntry)
+		for _, gif := range entry.results {
+			docs = append(docs, Document{Gif: gif, Text: []string{entry.text}})
+		}
+	}
+	return docs
+}
+
+func copyGifs(results []Gif) []Gif {
+	if results == nil {
+		return nil
+	}
+	return append([]Gif(nil), results...)
+}
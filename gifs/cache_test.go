@@ -0,0 +1,227 @@
+package gifs
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingProvider answers each query with a gif named after it, counting
+// calls. With a gate, calls wait for it to be closed.
+type countingProvider struct {
+	mu    sync.Mutex
+	calls map[string]int
+	err   error
+	gate  chan struct{}
+}
+
+func (p *countingProvider) Name() string {
+	return "counting"
+}
+
+func (p *countingProvider) Search(query string, opts Options) ([]Gif, error) {
+	p.mu.Lock()
+	p.calls[query]++
+	err, gate := p.err, p.gate
+	p.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []Gif{{Provider: "counting", ID: query, Title: query}}, nil
+}
+
+func (p *countingProvider) count(query string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[query]
+}
+
+func (p *countingProvider) fail(err error) {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
+
+type fakeNow struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (f *fakeNow) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeNow) Add(d time.Duration) {
+	f.mu.Lock()
+	f.t = f.t.Add(d)
+	f.mu.Unlock()
+}
+
+func newTestCache(size int) (*Cache, *countingProvider, *fakeNow) {
+	upstream := &countingProvider{calls: map[string]int{}}
+	clock := &fakeNow{t: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)}
+	c := NewCache(upstream, size, time.Minute)
+	c.now = clock.Now
+	return c, upstream, clock
+}
+
+// waitIdle waits for background refreshes to finish.
+func waitIdle(t *testing.T, c *Cache) {
+	for i := 0; i < 500; i++ {
+		c.mu.Lock()
+		n := len(c.inflight)
+		c.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("a refresh never finished")
+}
+
+func search(t *testing.T, c *Cache, query string) []Gif {
+	results, err := c.Search(query, Options{})
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return results
+}
+
+func TestCacheHitsAndMisses(t *testing.T) {
+	c, upstream, _ := newTestCache(10)
+	search(t, c, "sheep")
+	search(t, c, "sheep")
+	search(t, c, "  Sheep ")
+	search(t, c, "goats")
+
+	if n := upstream.count("sheep"); n != 1 {
+		t.Errorf("sheep fetched %d times, want 1", n)
+	}
+	want := CacheStats{Hits: 2, Misses: 2, Entries: 2}
+	if got := c.Stats(); got != want {
+		t.Errorf("stats %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, upstream, _ := newTestCache(2)
+	search(t, c, "a")
+	search(t, c, "b")
+	search(t, c, "a") // b is now the least recently used
+	search(t, c, "c")
+
+	search(t, c, "a")
+	if n := upstream.count("a"); n != 1 {
+		t.Errorf("a fetched %d times, want 1", n)
+	}
+	search(t, c, "b")
+	if n := upstream.count("b"); n != 2 {
+		t.Errorf("b fetched %d times, want 2 since it was evicted", n)
+	}
+	if entries := c.Stats().Entries; entries != 2 {
+		t.Errorf("%d entries, want 2", entries)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c, upstream, clock := newTestCache(10)
+	search(t, c, "sheep")
+
+	clock.Add(59 * time.Second)
+	search(t, c, "sheep")
+	if n := upstream.count("sheep"); n != 1 {
+		t.Fatalf("fetched %d times within the ttl, want 1", n)
+	}
+
+	// Past the ttl, the old results are served while they're refreshed.
+	clock.Add(2 * time.Second)
+	search(t, c, "sheep")
+	waitIdle(t, c)
+	if n := upstream.count("sheep"); n != 2 {
+		t.Errorf("fetched %d times after the ttl, want 2", n)
+	}
+	if stale := c.Stats().Stale; stale != 1 {
+		t.Errorf("%d stale, want 1", stale)
+	}
+
+	// The refresh counts from when it happened.
+	search(t, c, "sheep")
+	if n := upstream.count("sheep"); n != 2 {
+		t.Errorf("fetched %d times after refreshing, want 2", n)
+	}
+
+	// Too stale to serve while refreshing: wait for it.
+	clock.Add(time.Minute + maxStale)
+	search(t, c, "sheep")
+	if n := upstream.count("sheep"); n != 3 {
+		t.Errorf("fetched %d times when too stale, want 3", n)
+	}
+}
+
+func TestCacheServesStaleOnError(t *testing.T) {
+	c, upstream, clock := newTestCache(10)
+	search(t, c, "sheep")
+	clock.Add(time.Minute + maxStale)
+
+	upstream.fail(errors.New("giphy is down"))
+	results := search(t, c, "sheep")
+	if len(results) != 1 || results[0].ID != "sheep" {
+		t.Errorf("got %v, want the stale results", results)
+	}
+	if stale := c.Stats().Stale; stale != 1 {
+		t.Errorf("%d stale, want 1", stale)
+	}
+
+	// Nothing matching isn't a failure; the old results don't stand in.
+	upstream.fail(ErrNoResults)
+	if _, err := c.Search("sheep", Options{}); err != ErrNoResults {
+		t.Errorf("got %v, want ErrNoResults", err)
+	}
+
+	// And there's nothing to fall back on for a new query.
+	upstream.fail(errors.New("giphy is down"))
+	if _, err := c.Search("goats", Options{}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCacheCoalesces(t *testing.T) {
+	c, upstream, _ := newTestCache(10)
+	upstream.gate = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if results := search(t, c, "sheep"); len(results) != 1 {
+				t.Errorf("got %v", results)
+			}
+		}()
+	}
+	// Let them all pile up on the one call before it answers.
+	for i := 0; i < 500 && c.Stats().Misses < 10; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	close(upstream.gate)
+	wg.Wait()
+
+	if n := upstream.count("sheep"); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestCacheResultsAreCopies(t *testing.T) {
+	c, _, _ := newTestCache(10)
+	results := search(t, c, "sheep")
+	results[0].Title = "scribbled on"
+	if again := search(t, c, "sheep"); again[0].Title != "sheep" {
+		t.Errorf("the cached results changed: %v", again)
+	}
+}
@@ -0,0 +1,207 @@
+package gifs
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/store"
+)
+
+// CollectionPrefix marks a query as asking for a collection's gifs, as in
+// "collection:retro-wins".
+const CollectionPrefix = "collection:"
+
+var (
+	ErrNoCollection   = errors.New("no such collection")
+	ErrBadCollection  = errors.New("collection names are letters, numbers, - and _")
+	validCollectionRE = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+// Collection is a named set of saved gifs, most recently saved first.
+type Collection struct {
+	Name    string    `json:"name"`
+	Gifs    []Gif     `json:"gifs"`
+	Updated time.Time `json:"updated"`
+}
+
+// Collections keeps named collections of favorite gifs, saved to a json file
+// whenever they change. It's also a Provider: searching for
+// "collection:<name>" returns that collection, and any gif saved in a
+// collection can be looked up without asking its provider.
+type Collections struct {
+	path string
+
+	mu          sync.RWMutex
+	collections map[string]*Collection
+}
+
+// NewCollections loads any collections saved at path.
+func NewCollections(path string) (*Collections, error) {
+	c := &Collections{path: path, collections: map[string]*Collection{}}
+	if err := store.Load(path, &c.collections); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Collections) Name() string {
+	return "collections"
+}
+
+func (c *Collections) Search(query string, opts Options) ([]Gif, error) {
+	query = Normalize(query)
+	if !strings.HasPrefix(query, CollectionPrefix) {
+		return nil, ErrUnsupported
+	}
+	collection, err := c.Collection(strings.TrimPrefix(query, CollectionPrefix))
+	if err == ErrNoCollection {
+		return nil, ErrNoResults
+	}
+	if err != nil {
+		return nil, err
+	}
+	results, err := filterRating(collection.Gifs, opts.Rating)
+	if err != nil {
+		return nil, err
+	}
+	if results = page(results, opts); len(results) == 0 {
+		return nil, ErrNoResults
+	}
+	return results, nil
+}
+
+// Get finds a saved gif, so that permalinks to favorites keep working even
+// when its provider doesn't.
+func (c *Collections) Get(provider, id string, opts Options) (Gif, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, collection := range c.collections {
+		for _, gif := range collection.Gifs {
+			if gif.Provider == provider && gif.ID == id && allowed(gif, opts.Rating) {
+				return gif, nil
+			}
+		}
+	}
+	return Gif{}, ErrUnsupported
+}
+
+// Documents returns every saved gif, findable by its collections' names.
+func (c *Collections) Documents() []Document {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var docs []Document
+	for _, collection := range c.collections {
+		for _, gif := range collection.Gifs {
+			docs = append(docs, Document{Gif: gif, Text: []string{collection.Name}})
+		}
+	}
+	return docs
+}
+
+// List returns every collection, most recently updated first.
+func (c *Collections) List() []Collection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := make([]Collection, 0, len(c.collections))
+	for _, collection := range c.collections {
+		copied := *collection
+		copied.Gifs = copyGifs(collection.Gifs)
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list
+}
+
+// Collection returns a copy of the named collection.
+func (c *Collections) Collection(name string) (Collection, error) {
+	name = collectionName(name)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	collection, ok := c.collections[name]
+	if !ok {
+		return Collection{}, ErrNoCollection
+	}
+	copied := *collection
+	copied.Gifs = copyGifs(collection.Gifs)
+	return copied, nil
+}
+
+// Shuffle returns a random gif from the named collection.
+func (c *Collections) Shuffle(name string) (Gif, error) {
+	collection, err := c.Collection(name)
+	if err != nil {
+		return Gif{}, err
+	}
+	if len(collection.Gifs) == 0 {
+		return Gif{}, ErrNoResults
+	}
+	return collection.Gifs[rand.Intn(len(collection.Gifs))], nil
+}
+
+// Save adds gif to the named collection, creating it if needed. Saving a gif
+// that's already there moves it to the front.
+func (c *Collections) Save(name string, gif Gif) error {
+	name = collectionName(name)
+	if !validCollectionRE.MatchString(name) {
+		return ErrBadCollection
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	collection, ok := c.collections[name]
+	if !ok {
+		collection = &Collection{Name: name}
+		c.collections[name] = collection
+	}
+	gifs := []Gif{gif}
+	for _, saved := range collection.Gifs {
+		if saved.Provider != gif.Provider || saved.ID != gif.ID {
+			gifs = append(gifs, saved)
+		}
+	}
+	collection.Gifs = gifs
+	collection.Updated = time.Now()
+	return store.Save(c.path, c.collections)
+}
+
+// Remove takes a gif out of the named collection.
+func (c *Collections) Remove(name, provider, id string) error {
+	name = collectionName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	collection, ok := c.collections[name]
+	if !ok {
+		return ErrNoCollection
+	}
+	// A new slice, so nothing still holding the old one sees it change.
+	gifs := make([]Gif, 0, len(collection.Gifs))
+	for _, saved := range collection.Gifs {
+		if saved.Provider != provider || saved.ID != id {
+			gifs = append(gifs, saved)
+		}
+	}
+	collection.Gifs = gifs
+	collection.Updated = time.Now()
+	return store.Save(c.path, c.collections)
+}
+
+// Delete removes the named collection entirely.
+func (c *Collections) Delete(name string) error {
+	name = collectionName(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.collections[name]; !ok {
+		return ErrNoCollection
+	}
+	delete(c.collections, name)
+	return store.Save(c.path, c.collections)
+}
+
+// Collection names are case insensitive.
+func collectionName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,56 @@
+package gifs
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCollectionsListWhileRemoving(t *testing.T) {
+	c, err := NewCollections(filepath.Join(t.TempDir(), "collections.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := c.Save("faves", Gif{Provider: "giphy", ID: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := c.List()[0].Gifs
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i += 2 {
+		wg.Add(2)
+		go func(id string) {
+			defer wg.Done()
+			if err := c.Remove("faves", "giphy", id); err != nil {
+				t.Error(err)
+			}
+		}(strconv.Itoa(i))
+		go func() {
+			defer wg.Done()
+			for _, collection := range c.List() {
+				for _, gif := range collection.Gifs {
+					_ = gif.ID
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(before) != 20 || before[0].ID != "19" || before[19].ID != "0" {
+		t.Errorf("an earlier listing changed: %v", ids(before))
+	}
+	if after := c.List()[0].Gifs; len(after) != 10 {
+		t.Errorf("left %v, want the 10 odd ones", ids(after))
+	}
+}
+
+func ids(results []Gif) []string {
+	var ids []string
+	for _, gif := range results {
+		ids = append(ids, gif.ID)
+	}
+	return ids
+}
@@ -0,0 +1,278 @@
+package gifs
+
+import (
+	"container/list"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"log"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// How many bits, on average per sampled frame, two fingerprints may differ
+// by and still be the same clip.
+const duplicateDistance = 10
+
+// Fingerprint is a gif's difference hash (dHash) at a few points through its
+// animation: the first frame, the middle and the last.
+type Fingerprint []uint64
+
+// Distance is the average number of bits by which two fingerprints' frames
+// differ, or -1 if they can't be compared.
+func (f Fingerprint) Distance(other Fingerprint) int {
+	n := len(f)
+	if len(other) < n {
+		n = len(other)
+	}
+	if n == 0 {
+		return -1
+	}
+	total := 0
+	for i := 0; i < n; i++ {
+		total += bits.OnesCount64(f[i] ^ other[i])
+	}
+	return total / n
+}
+
+// Dedupe is a Provider that drops results which look like an earlier result,
+// since the same clip is often uploaded over and over. Each gif's media is
+// fetched with open and fingerprinted by a bounded pool of workers, and
+// fingerprints are remembered by gif for as long as they're among the size
+// most recently used. Results that can't be fingerprinted within wait are
+// kept as they are.
+type Dedupe struct {
+	Provider
+	open func(gif Gif, rendition string) (io.ReadCloser, error)
+	wait time.Duration
+	sem  chan struct{}
+	size int
+
+	mu       sync.Mutex
+	lru      *list.List
+	entries  map[string]*list.Element
+	inflight map[string]*hashCall
+}
+
+type hashEntry struct {
+	key         string
+	fingerprint Fingerprint
+}
+
+type hashCall struct {
+	done        chan struct{}
+	fingerprint Fingerprint
+}
+
+func NewDedupe(provider Provider, open func(gif Gif, rendition string) (io.ReadCloser, error), workers, size int, wait time.Duration) *Dedupe {
+	return &Dedupe{
+		Provider: provider,
+		open:     open,
+		wait:     wait,
+		sem:      make(chan struct{}, workers),
+		size:     size,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*hashCall{},
+	}
+}
+
+func (d *Dedupe) Search(query string, opts Options) ([]Gif, error) {
+	results, err := d.Provider.Search(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.dedupe(results), nil
+}
+
+func (d *Dedupe) Trending(opts Options) ([]Gif, error) {
+	trender, ok := d.Provider.(Trender)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	results, err := trender.Trending(opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.dedupe(results), nil
+}
+
+func (d *Dedupe) Random(tag string, opts Options) (Gif, error) {
+	randomizer, ok := d.Provider.(Randomizer)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	return randomizer.Random(tag, opts)
+}
+
+func (d *Dedupe) Get(provider, id string, opts Options) (Gif, error) {
+	getter, ok := d.Provider.(Getter)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	return getter.Get(provider, id, opts)
+}
+
+// dedupe keeps the first of each set of near-duplicates in results.
+func (d *Dedupe) dedupe(results []Gif) []Gif {
+	calls := make([]*hashCall, len(results))
+	for i, gif := range results {
+		calls[i] = d.fingerprint(gif)
+	}
+
+	// Whatever isn't done in time is kept, and will be ready next time.
+	timeout := time.After(d.wait)
+	fingerprints := make([]Fingerprint, len(results))
+wait:
+	for i, call := range calls {
+		select {
+		case <-call.done:
+			fingerprints[i] = call.fingerprint
+		case <-timeout:
+			break wait
+		}
+	}
+
+	var kept []Gif
+	var keptFingerprints []Fingerprint
+	for i, gif := range results {
+		duplicate := false
+		for _, seen := range keptFingerprints {
+			if distance := fingerprints[i].Distance(seen); distance >= 0 && distance <= duplicateDistance {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, gif)
+			keptFingerprints = append(keptFingerprints, fingerprints[i])
+		}
+	}
+	return kept
+}
+
+// fingerprint returns gif's remembered fingerprint, or starts working it out.
+func (d *Dedupe) fingerprint(gif Gif) *hashCall {
+	key := gif.Provider + ":" + gif.ID
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.entries[key]; ok {
+		d.lru.MoveToFront(el)
+		call := &hashCall{done: make(chan struct{}), fingerprint: el.Value.(*hashEntry).fingerprint}
+		close(call.done)
+		return call
+	}
+	if call, ok := d.inflight[key]; ok {
+		return call
+	}
+	call := &hashCall{done: make(chan struct{})}
+	d.inflight[key] = call
+	go func() {
+		d.sem <- struct{}{}
+		fingerprint, err := d.hash(gif)
+		<-d.sem
+		if err != nil {
+			// Remembered as unhashable all the same, rather than fetched for
+			// every search it turns up in.
+			log.Println("ERROR:", "gifs: fingerprint", key+":", err.Error())
+		}
+
+		d.mu.Lock()
+		delete(d.inflight, key)
+		call.fingerprint = fingerprint
+		d.entries[key] = d.lru.PushFront(&hashEntry{key: key, fingerprint: fingerprint})
+		for d.lru.Len() > d.size {
+			oldest := d.lru.Back()
+			d.lru.Remove(oldest)
+			delete(d.entries, oldest.Value.(*hashEntry).key)
+		}
+		d.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// hash fetches gif's smallest gif rendition and fingerprints it. Gifs that
+// only come as video aren't fingerprinted.
+func (d *Dedupe) hash(g Gif) (Fingerprint, error) {
+	name, best := "", 0
+	for n, r := range g.Renditions {
+		if r.Format != "gif" {
+			continue
+		}
+		if area := r.Width * r.Height; name == "" || (area > 0 && (best == 0 || area < best)) {
+			name, best = n, area
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+	body, err := d.open(g, name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	decoded, err := gif.DecodeAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return fingerprintFrames(decoded), nil
+}
+
+// fingerprintFrames plays g onto a canvas, hashing the first, middle and last
+// frames. Frames only cover what changed, so each is drawn over the last.
+func fingerprintFrames(g *gif.GIF) Fingerprint {
+	n := len(g.Image)
+	if n == 0 {
+		return nil
+	}
+	samples := map[int]bool{0: true, n / 2: true, n - 1: true}
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var fingerprint Fingerprint
+	for i, frame := range g.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if samples[i] {
+			fingerprint = append(fingerprint, dHash(canvas))
+		}
+	}
+	return fingerprint
+}
+
+// dHash shrinks img to 9x8 grayscale and records, for each pixel, whether
+// it's brighter than the one to its right.
+func dHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0
+	}
+	var gray [8][9]uint64
+	for y := 0; y < 8; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/8
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/8
+		for x := 0; x < 9; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/9
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/9
+			var sum, count uint64
+			for py := y0; py < y1 || py == y0; py++ {
+				for px := x0; px < x1 || px == x0; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000
+					count++
+				}
+			}
+			gray[y][x] = sum / count
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,32 @@
+package gifs
+
+// Gif is a single search result, normalized across providers.
+type Gif struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Title    string `json:"title"`
+	Rating   string `json:"rating,omitempty"`
+	PageURL  string `json:"page_url,omitempty"`
+
+	// Renditions are keyed by name ("original", "downsized", "fixed_height",
+	// "original_mp4", ...). Every provider fills in at least "original".
+	Renditions map[string]Rendition `json:"renditions"`
+}
+
+// Rendition is one encoding of a gif's media.
+type Rendition struct {
+	URL    string `json:"url"`
+	Format string `json:"format"` // "gif", "mp4" or "webp"
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Frames int    `json:"frames,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+
+	// Duration is how long one loop plays, in seconds.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// URL returns the url of the original rendition.
+func (g Gif) URL() string {
+	return g.Renditions["original"].URL
+}
@@ -0,0 +1,65 @@
+package gifs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errBadGif = errors.New("not a readable gif")
+
+// gifFrames counts a gif's frames and the pixels they'd take to decode, by
+// stepping over its blocks without decompressing any of them.
+func gifFrames(data []byte) (frames int, pixels int64, err error) {
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return 0, 0, errBadGif
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		// Global color table.
+		i += 3 << (data[10]&7 + 1)
+	}
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // Extension: introducer, label, then sub-blocks.
+			if i, err = skipSubBlocks(data, i+2); err != nil {
+				return 0, 0, err
+			}
+		case 0x2c: // Image descriptor, local color table, lzw code size, sub-blocks.
+			if i+10 > len(data) {
+				return 0, 0, errBadGif
+			}
+			width := int64(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[i+7:]))
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << (packed&7 + 1)
+			}
+			if i, err = skipSubBlocks(data, i+1); err != nil {
+				return 0, 0, err
+			}
+			frames++
+			pixels += width * height
+		case 0x3b: // Trailer.
+			return frames, pixels, nil
+		default:
+			return 0, 0, errBadGif
+		}
+	}
+	return frames, pixels, nil
+}
+
+// skipSubBlocks returns where the run of sub-blocks starting at i ends.
+func skipSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errBadGif
+		}
+		n := int(data[i])
+		i++
+		if n == 0 {
+			return i, nil
+		}
+		i += n
+	}
+}
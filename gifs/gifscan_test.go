@@ -0,0 +1,54 @@
+package gifs
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+func encodeGif(t *testing.T, width, height, frames int) []byte {
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGifFrames(t *testing.T) {
+	data := encodeGif(t, 20, 10, 3)
+	frames, pixels, err := gifFrames(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != 3 || pixels != 600 {
+		t.Errorf("got %d frames, %d pixels; want 3, 600", frames, pixels)
+	}
+
+	if _, _, err := gifFrames(data[:len(data)/2]); err == nil {
+		t.Error("truncated: expected an error")
+	}
+	if _, _, err := gifFrames([]byte("not a gif at all")); err == nil {
+		t.Error("not a gif: expected an error")
+	}
+}
+
+func TestAddTooManyFrames(t *testing.T) {
+	library, err := NewLibrary(t.TempDir(), "/library/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tiny, but more frames than are worth decoding.
+	if _, err := library.Add(encodeGif(t, 1, 1, MaxUploadFrames+1), Sidecar{}); err != ErrUploadTooBig {
+		t.Errorf("too many frames: got %v, want ErrUploadTooBig", err)
+	}
+	if _, err := library.Add(encodeGif(t, 1, 1, 5), Sidecar{Title: "dot"}); err != nil {
+		t.Errorf("small gif: %v", err)
+	}
+}
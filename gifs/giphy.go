@@ -0,0 +1,121 @@
+package gifs
+
+import (
+	"strings"
+
+	"github.com/kevin-cantwell/kvn/giphy"
+)
+
+// Giphy searches api.giphy.com.
+type Giphy struct {
+	client *giphy.Client
+}
+
+func NewGiphy(apiKey string) *Giphy {
+	return &Giphy{client: giphy.NewClient(apiKey)}
+}
+
+func (g *Giphy) Name() string {
+	return "giphy"
+}
+
+func (g *Giphy) Search(query string, opts Options) ([]Gif, error) {
+	resp, err := g.client.Search(giphy.SearchParams{
+		Query:  query,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Rating: opts.Rating,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return giphyGifs(resp.Data), nil
+}
+
+func (g *Giphy) Trending(opts Options) ([]Gif, error) {
+	resp, err := g.client.Trending(giphy.TrendingParams{
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Rating: opts.Rating,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return giphyGifs(resp.Data), nil
+}
+
+func (g *Giphy) Random(tag string, opts Options) (Gif, error) {
+	resp, err := g.client.Random(giphy.RandomParams{Tag: tag, Rating: opts.Rating})
+	if err == giphy.ErrNotFound {
+		return Gif{}, ErrNoResults
+	}
+	if err != nil {
+		return Gif{}, err
+	}
+	gif := giphyGif(resp.Data)
+	if gif.URL() == "" {
+		return Gif{}, ErrNoResults
+	}
+	return gif, nil
+}
+
+func (g *Giphy) Get(provider, id string, opts Options) (Gif, error) {
+	if provider != g.Name() {
+		return Gif{}, ErrUnsupported
+	}
+	resp, err := g.client.GetByID(id)
+	if err == giphy.ErrNotFound {
+		return Gif{}, ErrNoResults
+	}
+	if err != nil {
+		return Gif{}, err
+	}
+	return giphyGif(resp.Data), nil
+}
+
+func giphyGifs(data []giphy.GIF) []Gif {
+	results := make([]Gif, 0, len(data))
+	for _, d := range data {
+		if gif := giphyGif(d); gif.URL() != "" {
+			results = append(results, gif)
+		}
+	}
+	return results
+}
+
+func giphyGif(d giphy.GIF) Gif {
+	gif := Gif{
+		ID:         d.ID,
+		Provider:   "giphy",
+		Title:      d.Title,
+		Rating:     d.Rating,
+		PageURL:    d.URL,
+		Renditions: map[string]Rendition{},
+	}
+	for name, image := range d.Images {
+		if strings.HasSuffix(name, "_still") {
+			continue
+		}
+		base := Rendition{Width: int(image.Width), Height: int(image.Height), Frames: int(image.Frames)}
+
+		// Each of giphy's renditions may come in several formats.
+		for _, format := range []struct {
+			url    string
+			size   giphy.Number
+			name   string
+			format string
+		}{
+			{image.URL, image.Size, name, "gif"},
+			{image.MP4, image.MP4Size, strings.TrimSuffix(name, "_mp4") + "_mp4", "mp4"},
+			{image.WebP, image.WebPSize, name + "_webp", "webp"},
+		} {
+			if format.url == "" {
+				continue
+			}
+			r := base
+			r.URL, r.Size, r.Format = format.url, int64(format.size), format.format
+			gif.Renditions[format.name] = r
+		}
+	}
+	return gif
+}
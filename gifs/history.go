@@ -0,0 +1,126 @@
+package gifs
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// How many pages deep Pick will look for something new before starting over.
+const maxHistoryPages = 4
+
+// History remembers which gifs have been shown for a key (typically a
+// session and query) so that retries don't repeat themselves. It holds at
+// most size keys, forgetting the least recently used, and forgets any key
+// untouched for ttl.
+type History struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type historyEntry struct {
+	key     string
+	shown   map[string]bool
+	offset  int
+	touched time.Time
+}
+
+func NewHistory(size int, ttl time.Duration) *History {
+	return &History{
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Pick searches from where key last left off and picks a random result that
+// hasn't been shown for key, paging deeper as pages run out. pageSize is how
+// far each search goes upstream, which may be further than the results it
+// returns once they're filtered. It returns the page it picked from and the
+// index of the pick.
+func (h *History) Pick(key string, pageSize int, search func(offset int) ([]Gif, error)) ([]Gif, int, error) {
+	h.mu.Lock()
+	offset := h.entry(key).offset
+	h.mu.Unlock()
+
+	var results []Gif
+	for page := 0; page < maxHistoryPages; page++ {
+		var err error
+		results, err = search(offset)
+		if err == ErrNoResults && offset > 0 {
+			// Ran off the end of the results; start over.
+			h.Forget(key)
+			offset = 0
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		h.mu.Lock()
+		entry := h.entry(key)
+		var unseen []int
+		for i, gif := range results {
+			if !entry.shown[gif.Provider+":"+gif.ID] {
+				unseen = append(unseen, i)
+			}
+		}
+		if len(unseen) > 0 {
+			n := unseen[rand.Intn(len(unseen))]
+			entry.shown[results[n].Provider+":"+results[n].ID] = true
+			entry.offset = offset
+			h.mu.Unlock()
+			return results, n, nil
+		}
+		offset += pageSize
+		entry.offset = offset
+		h.mu.Unlock()
+	}
+
+	// Everything we looked at has been seen.
+	h.Forget(key)
+	if len(results) == 0 {
+		return nil, 0, ErrNoResults
+	}
+	return results, rand.Intn(len(results)), nil
+}
+
+// Forget clears everything shown for key.
+func (h *History) Forget(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if el, ok := h.entries[key]; ok {
+		h.lru.Remove(el)
+		delete(h.entries, key)
+	}
+}
+
+// entry returns key's entry, creating it if it's missing or expired.
+// h.mu must be held.
+func (h *History) entry(key string) *historyEntry {
+	now := time.Now()
+	if el, ok := h.entries[key]; ok {
+		entry := el.Value.(*historyEntry)
+		if now.Sub(entry.touched) < h.ttl {
+			entry.touched = now
+			h.lru.MoveToFront(el)
+			return entry
+		}
+		h.lru.Remove(el)
+		delete(h.entries, key)
+	}
+	entry := &historyEntry{key: key, shown: map[string]bool{}, touched: now}
+	h.entries[key] = h.lru.PushFront(entry)
+	for h.lru.Len() > h.size {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.entries, oldest.Value.(*historyEntry).key)
+	}
+	return entry
+}
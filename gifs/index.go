@@ -0,0 +1,311 @@
+package gifs
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// BM25 tuning, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// How much looser matches count for, relative to an exact term.
+const (
+	prefixWeight = 0.5
+	typoWeight   = 0.3
+)
+
+// Document is a gif and the text it should be found by.
+type Document struct {
+	Gif  Gif
+	Text []string
+}
+
+// Indexable is anything with gifs worth searching locally.
+type Indexable interface {
+	Documents() []Document
+}
+
+// Index is a Provider that full-text searches gif metadata held in process:
+// titles, tags, collection names, the queries gifs were found with. Terms are
+// stemmed, match by prefix and tolerate typos, and results are ranked with
+// BM25.
+type Index struct {
+	sources []Indexable
+
+	mu       sync.RWMutex
+	docs     map[string]*indexDoc
+	postings map[string]map[string]int // term -> doc key -> term frequency
+	avgLen   float64
+}
+
+type indexDoc struct {
+	gif    Gif
+	length int
+}
+
+// NewIndex indexes the documents of sources. Call Rebuild or Watch to pick
+// up changes to them.
+func NewIndex(sources ...Indexable) *Index {
+	ix := &Index{sources: sources}
+	ix.Rebuild()
+	return ix
+}
+
+func (ix *Index) Name() string {
+	return "index"
+}
+
+// Watch rebuilds the index from its sources every interval.
+func (ix *Index) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		ix.Rebuild()
+	}
+}
+
+// Rebuild re-reads every source.
+func (ix *Index) Rebuild() {
+	var docs []Document
+	for _, source := range ix.sources {
+		docs = append(docs, source.Documents()...)
+	}
+	ix.Reset(docs)
+}
+
+// Reset replaces everything in the index with docs. Documents for the same
+// gif are merged.
+func (ix *Index) Reset(docs []Document) {
+	indexed := map[string]*indexDoc{}
+	postings := map[string]map[string]int{}
+	total := 0
+	for _, doc := range docs {
+		key := doc.Gif.Provider + ":" + doc.Gif.ID
+		texts := doc.Text
+		d, ok := indexed[key]
+		if !ok {
+			d = &indexDoc{gif: doc.Gif}
+			indexed[key] = d
+			// A new slice: sources hand out their own, and another index
+			// may be reading it.
+			texts = append([]string{doc.Gif.Title}, doc.Text...)
+		}
+		for _, text := range texts {
+			for _, term := range terms(text) {
+				if postings[term] == nil {
+					postings[term] = map[string]int{}
+				}
+				postings[term][key]++
+				d.length++
+				total++
+			}
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.docs, ix.postings = indexed, postings
+	ix.avgLen = 0
+	if len(indexed) > 0 {
+		ix.avgLen = float64(total) / float64(len(indexed))
+	}
+}
+
+// Documents returns everything indexed, so that indexes can feed each other.
+func (ix *Index) Documents() []Document {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	docs := make([]Document, 0, len(ix.docs))
+	for _, d := range ix.docs {
+		docs = append(docs, Document{Gif: d.gif})
+	}
+	return docs
+}
+
+// Search returns ErrNoResults rather than an empty page, so that as the last
+// resort in a Chain it doesn't hide why the providers before it failed.
+func (ix *Index) Search(query string, opts Options) ([]Gif, error) {
+	results := ix.rank(query, opts)
+	if len(results) == 0 {
+		return nil, ErrNoResults
+	}
+	return results, nil
+}
+
+// rank returns the page of gifs matching query, best match first.
+func (ix *Index) rank(query string, opts Options) []Gif {
+	ix.mu.RLock()
+	scores := map[string]float64{}
+	for _, qterm := range terms(query) {
+		for term, weight := range ix.expand(qterm) {
+			ix.score(scores, term, weight)
+		}
+	}
+
+	type scored struct {
+		gif   Gif
+		score float64
+	}
+	var ranked []scored
+	for key, score := range scores {
+		gif := ix.docs[key].gif
+		if allowed(gif, opts.Rating) {
+			ranked = append(ranked, scored{gif, score})
+		}
+	}
+	ix.mu.RUnlock()
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].gif.Title < ranked[j].gif.Title
+	})
+	results := make([]Gif, len(ranked))
+	for i, r := range ranked {
+		results[i] = r.gif
+	}
+	return page(results, opts)
+}
+
+func (ix *Index) Get(provider, id string, opts Options) (Gif, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	d, ok := ix.docs[provider+":"+id]
+	if !ok || !allowed(d.gif, opts.Rating) {
+		return Gif{}, ErrUnsupported
+	}
+	return d.gif, nil
+}
+
+// expand returns the indexed terms a query term matches, with how much each
+// counts: the term itself, terms it's a prefix of, and terms within a typo or
+// two of it. ix.mu must be held.
+func (ix *Index) expand(qterm string) map[string]float64 {
+	matches := map[string]float64{}
+	if _, ok := ix.postings[qterm]; ok {
+		matches[qterm] = 1
+	}
+	maxTypos := 0
+	switch {
+	case len(qterm) >= 8:
+		maxTypos = 2
+	case len(qterm) >= 4:
+		maxTypos = 1
+	}
+	for term := range ix.postings {
+		if term == qterm {
+			continue
+		}
+		if len(qterm) >= 2 && strings.HasPrefix(term, qterm) {
+			matches[term] = prefixWeight
+		} else if maxTypos > 0 && withinDistance(qterm, term, maxTypos) {
+			matches[term] = typoWeight
+		}
+	}
+	return matches
+}
+
+// score adds term's BM25 contribution to each document containing it.
+// ix.mu must be held.
+func (ix *Index) score(scores map[string]float64, term string, weight float64) {
+	docs := ix.postings[term]
+	n := float64(len(ix.docs))
+	idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+	for key, tf := range docs {
+		length := float64(ix.docs[key].length)
+		f := float64(tf)
+		scores[key] += weight * idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*length/ix.avgLen))
+	}
+}
+
+// terms splits text into lowercase, stemmed words.
+func terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = stem(word)
+	}
+	return words
+}
+
+// stem strips common English suffixes. It's a much lighter touch than a
+// real Porter stemmer, but it's enough that "sheeps" finds "sheep" and
+// "dancing" finds "dance".
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			word = word[:len(word)-len(suffix)]
+			// "dancing" -> "danc" -> "dance"; "stopped" -> "stopp" -> "stop"
+			if n := len(word); word[n-1] == word[n-2] && !strings.ContainsRune("lsz", rune(word[n-1])) {
+				word = word[:n-1]
+			} else if strings.HasSuffix(word, "c") || strings.HasSuffix(word, "v") || strings.HasSuffix(word, "at") {
+				word += "e"
+			}
+			break
+		}
+	}
+	return word
+}
+
+// withinDistance reports whether a and b are at most max edits apart
+// (Levenshtein distance).
+func withinDistance(a, b string, max int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return false
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < best {
+				best = cur[j]
+			}
+		}
+		if best > max {
+			return false
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)] <= max
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
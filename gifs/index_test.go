@@ -0,0 +1,128 @@
+package gifs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	for word, want := range map[string]string{
+		"sheeps":   "sheep",
+		"sheep":    "sheep",
+		"dancing":  "dance",
+		"danced":   "dance",
+		"stopped":  "stop",
+		"parties":  "party",
+		"glasses":  "glass",
+		"cats":     "cat",
+		"bus":      "bus",
+		"falling":  "fall",
+		"happy":    "happy",
+		"relaxing": "relax",
+	} {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestWithinDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		max  int
+		want bool
+	}{
+		{"sheep", "sheep", 0, true},
+		{"sheep", "shep", 1, true},
+		{"sheep", "sheeo", 1, true},
+		{"sheep", "shepe", 1, false},
+		{"sheep", "shepe", 2, true},
+		{"celebrate", "celbrat", 2, true},
+		{"cat", "dog", 2, false},
+	} {
+		if got := withinDistance(test.a, test.b, test.max); got != test.want {
+			t.Errorf("withinDistance(%q, %q, %d) = %v", test.a, test.b, test.max, got)
+		}
+	}
+}
+
+func testIndex() *Index {
+	ix := NewIndex()
+	ix.Reset([]Document{
+		{Gif: Gif{Provider: "giphy", ID: "1", Title: "dancing sheep", Rating: "g"}},
+		{Gif: Gif{Provider: "giphy", ID: "2", Title: "sheep sheep sheep", Rating: "g"}},
+		{Gif: Gif{Provider: "giphy", ID: "3", Title: "a sheep wanders through a very long field of grass", Rating: "g"}},
+		{Gif: Gif{Provider: "giphy", ID: "4", Title: "celebration", Rating: "pg-13"}, Text: []string{"party"}},
+		{Gif: Gif{Provider: "tenor", ID: "5", Title: "shocked cat", Rating: "g"}},
+	})
+	return ix
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := testIndex()
+	for _, test := range []struct {
+		name   string
+		query  string
+		rating string
+		want   []string // ids, best first
+	}{
+		// More mentions, then shorter titles, rank higher.
+		{"bm25", "sheep", "", []string{"2", "1", "3"}},
+		{"stem", "sheeps", "", []string{"2", "1", "3"}},
+		{"stem both ways", "dance", "", []string{"1"}},
+		{"prefix", "cele", "", []string{"4"}},
+		{"typo", "shoocked", "", []string{"5"}},
+		{"two typos in a long word", "celbraton", "", []string{"4"}},
+		{"other text", "parties", "", []string{"4"}},
+		{"exact beats loose", "cat", "", []string{"5"}},
+		{"rating", "celebration", "g", nil},
+		{"nothing", "zebra", "", nil},
+	} {
+		results, err := ix.Search(test.query, Options{Rating: test.rating})
+		if test.want == nil {
+			if err != ErrNoResults {
+				t.Errorf("%s: got %v, %v; want ErrNoResults", test.name, ids(results), err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := ids(results); !equalStrings(got, test.want) {
+			t.Errorf("%s: %q got %v, want %v", test.name, test.query, got, test.want)
+		}
+	}
+}
+
+func TestIndexResetLeavesSourcesAlone(t *testing.T) {
+	// Room to grow, like a slice a source keeps for itself.
+	text := make([]string, 1, 4)
+	text[0] = "party"
+	docs := []Document{{Gif: Gif{Provider: "library", ID: "1", Title: "celebration"}, Text: text}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			NewIndex().Reset(docs)
+		}()
+	}
+	wg.Wait()
+	if spare := text[:cap(text)]; spare[1] != "" {
+		t.Errorf("the source's slice was written to: %q", spare)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,405 @@
+package gifs
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/store"
+)
+
+// Every frame of an uploaded gif is decoded to check it, so these cap its
+// canvas, how many frames it has, and the pixels in all those frames.
+const (
+	MaxUploadPixels        = 2048 * 2048
+	MaxUploadFrames        = 2000
+	MaxUploadDecodedPixels = 128 << 20
+)
+
+var (
+	ErrBadUpload     = errors.New("only gifs and mp4s can be added to the library")
+	ErrCorruptUpload = errors.New("that file is corrupt")
+	ErrUploadTooBig  = errors.New("that gif is too big")
+)
+
+// Sidecar is the optional json file next to a library gif, named after it
+// with a .json extension (party.gif and party.json).
+type Sidecar struct {
+	Title  string   `json:"title,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Rating string   `json:"rating,omitempty"`
+
+	// Width and Height are only needed for mp4s, which aren't decoded.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// Library is a Provider that searches a directory of .gif and .mp4 files.
+// A .gif and .mp4 with the same name are renditions of one gif. Media urls
+// are under urlPrefix, to be served from Open.
+type Library struct {
+	dir       string
+	urlPrefix string
+
+	mu      sync.RWMutex
+	entries map[string]*libraryEntry // by id
+	search  *Index
+}
+
+type libraryEntry struct {
+	gif       Gif
+	tags      []string
+	files     map[string]string // extension -> path
+	signature string
+}
+
+// NewLibrary indexes dir.
+func NewLibrary(dir, urlPrefix string) (*Library, error) {
+	l := &Library{dir: dir, urlPrefix: urlPrefix, entries: map[string]*libraryEntry{}, search: NewIndex()}
+	return l, l.Refresh()
+}
+
+func (l *Library) Name() string {
+	return "local"
+}
+
+// Watch refreshes the index every interval, picking up added, changed and
+// removed files.
+func (l *Library) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := l.Refresh(); err != nil {
+			log.Println("ERROR:", "library:", err.Error())
+		}
+	}
+}
+
+// Refresh rescans the directory, only decoding files that have changed.
+func (l *Library) Refresh() error {
+	groups := map[string]map[string]os.FileInfo{} // base path -> extension -> info
+	err := filepath.Walk(l.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".gif" && ext != ".mp4" && ext != ".json" {
+			return nil
+		}
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		if groups[base] == nil {
+			groups[base] = map[string]os.FileInfo{}
+		}
+		groups[base][ext] = info
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]*libraryEntry{}
+	for base, files := range groups {
+		if files[".gif"] == nil && files[".mp4"] == nil {
+			continue
+		}
+		rel, err := filepath.Rel(l.dir, base)
+		if err != nil {
+			return err
+		}
+		id := libraryID(rel)
+
+		signature := ""
+		for _, ext := range []string{".gif", ".mp4", ".json"} {
+			if info := files[ext]; info != nil {
+				signature += fmt.Sprintf("%s:%d:%d;", ext, info.Size(), info.ModTime().UnixNano())
+			}
+		}
+
+		l.mu.RLock()
+		existing := l.entries[id]
+		l.mu.RUnlock()
+		if existing != nil && existing.signature == signature {
+			entries[id] = existing
+			continue
+		}
+
+		entry, err := l.index(id, base, rel, files)
+		if err != nil {
+			log.Println("ERROR:", "library:", rel+":", err.Error())
+			continue
+		}
+		entry.signature = signature
+		entries[id] = entry
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	l.search.Reset(l.Documents())
+	return nil
+}
+
+// Documents returns every gif in the library along with its tags.
+func (l *Library) Documents() []Document {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	docs := make([]Document, 0, len(l.entries))
+	for _, entry := range l.entries {
+		docs = append(docs, Document{Gif: entry.gif, Text: entry.tags})
+	}
+	return docs
+}
+
+// index reads one gif's files and sidecar.
+func (l *Library) index(id, base, rel string, files map[string]os.FileInfo) (*libraryEntry, error) {
+	var sidecar Sidecar
+	if files[".json"] != nil {
+		b, err := ioutil.ReadFile(base + ".json")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &sidecar); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &libraryEntry{
+		gif: Gif{
+			ID:         id,
+			Provider:   l.Name(),
+			Title:      sidecar.Title,
+			Rating:     sidecar.Rating,
+			Renditions: map[string]Rendition{},
+		},
+		tags:  sidecar.Tags,
+		files: map[string]string{},
+	}
+	if entry.gif.Title == "" {
+		entry.gif.Title = strings.NewReplacer("-", " ", "_", " ").Replace(filepath.Base(rel))
+	}
+	if entry.gif.Rating == "" {
+		// The library is curated by us.
+		entry.gif.Rating = "g"
+	}
+
+	if info := files[".gif"]; info != nil {
+		f, err := os.Open(base + ".gif")
+		if err != nil {
+			return nil, err
+		}
+		r, err := decodeGif(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.URL, r.Size = l.urlPrefix+id+".gif", info.Size()
+		entry.gif.Renditions["original"] = r
+		entry.files[".gif"] = base + ".gif"
+	}
+	if info := files[".mp4"]; info != nil {
+		data, err := ioutil.ReadFile(base + ".mp4")
+		if err != nil {
+			return nil, err
+		}
+		r, err := mp4Info(data)
+		if err != nil {
+			// Still playable, probably; we just don't know its size.
+			log.Println("ERROR:", "library:", rel+".mp4:", err.Error())
+			r = Rendition{Format: "mp4"}
+		}
+		r.URL, r.Size = l.urlPrefix+id+".mp4", info.Size()
+		if sidecar.Width > 0 {
+			r.Width, r.Height = sidecar.Width, sidecar.Height
+		}
+		if original, ok := entry.gif.Renditions["original"]; ok && r.Width == 0 {
+			r.Width, r.Height, r.Frames = original.Width, original.Height, original.Frames
+		}
+		entry.gif.Renditions["original_mp4"] = r
+		entry.files[".mp4"] = base + ".mp4"
+		if _, ok := entry.gif.Renditions["original"]; !ok {
+			// Everything expects an original; an mp4 alone will have to do.
+			entry.gif.Renditions["original"] = r
+		}
+	}
+	return entry, nil
+}
+
+// decodeGif reads a gif's dimensions, frame count and duration.
+func decodeGif(r io.Reader) (Rendition, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return Rendition{}, err
+	}
+	delay := 0
+	for _, d := range g.Delay {
+		delay += d
+	}
+	return Rendition{
+		Format:   "gif",
+		Width:    g.Config.Width,
+		Height:   g.Config.Height,
+		Frames:   len(g.Image),
+		Duration: float64(delay) / 100,
+	}, nil
+}
+
+// libraryID is the id of the gif at rel, a path relative to the library
+// without an extension.
+func libraryID(rel string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(rel)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Add stores an uploaded gif or mp4 in the library's uploads directory, named
+// by the sha256 of its contents, with sidecar next to it. Uploading the same
+// file again adds to its tags rather than making a copy.
+func (l *Library) Add(data []byte, sidecar Sidecar) (Gif, error) {
+	var ext string
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		ext = ".gif"
+		config, err := gif.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return Gif{}, ErrCorruptUpload
+		}
+		if config.Width*config.Height > MaxUploadPixels {
+			return Gif{}, ErrUploadTooBig
+		}
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return Gif{}, ErrCorruptUpload
+		}
+		if frames > MaxUploadFrames || pixels > MaxUploadDecodedPixels {
+			return Gif{}, ErrUploadTooBig
+		}
+		if _, err := decodeGif(bytes.NewReader(data)); err != nil {
+			return Gif{}, ErrCorruptUpload
+		}
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		ext = ".mp4"
+		if _, err := mp4Info(data); err != nil {
+			return Gif{}, ErrCorruptUpload
+		}
+	default:
+		return Gif{}, ErrBadUpload
+	}
+	if sidecar.Rating != "" {
+		rating, err := ParseRating(sidecar.Rating)
+		if err != nil {
+			return Gif{}, err
+		}
+		sidecar.Rating = rating
+	}
+
+	sum := sha256.Sum256(data)
+	rel := filepath.Join("uploads", hex.EncodeToString(sum[:]))
+	base := filepath.Join(l.dir, rel)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return Gif{}, err
+	}
+
+	var existing Sidecar
+	if err := store.Load(base+".json", &existing); err != nil {
+		return Gif{}, err
+	}
+	if sidecar.Title == "" {
+		sidecar.Title = existing.Title
+	}
+	if sidecar.Rating == "" {
+		sidecar.Rating = existing.Rating
+	}
+	seen := map[string]bool{}
+	var tags []string
+	for _, tag := range append(existing.Tags, sidecar.Tags...) {
+		if tag = Normalize(tag); tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sidecar.Tags = tags
+
+	if _, err := os.Stat(base + ext); os.IsNotExist(err) {
+		if err := writeFile(base+ext, data); err != nil {
+			return Gif{}, err
+		}
+	}
+	if err := store.Save(base+".json", sidecar); err != nil {
+		return Gif{}, err
+	}
+	if err := l.Refresh(); err != nil {
+		return Gif{}, err
+	}
+	return l.Get(l.Name(), libraryID(rel), Options{})
+}
+
+// writeFile writes data to path all at once, so that a Refresh never sees
+// half a file.
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Search ranks gifs by how well their title and tags match the query.
+func (l *Library) Search(query string, opts Options) ([]Gif, error) {
+	return l.search.rank(query, opts), nil
+}
+
+func (l *Library) Get(provider, id string, opts Options) (Gif, error) {
+	if provider != l.Name() {
+		return Gif{}, ErrUnsupported
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entry, ok := l.entries[id]
+	if !ok {
+		return Gif{}, ErrNoResults
+	}
+	return entry.gif, nil
+}
+
+// Open returns the path of a gif's file with the given extension.
+func (l *Library) Open(id, ext string) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entry, ok := l.entries[id]
+	if !ok {
+		return "", false
+	}
+	path, ok := entry.files[ext]
+	return path, ok
+}
+
+// page applies opts' offset and limit to results.
+func page(results []Gif, opts Options) []Gif {
+	if opts.Offset >= len(results) {
+		return nil
+	}
+	results = results[opts.Offset:]
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results
+}
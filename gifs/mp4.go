@@ -0,0 +1,94 @@
+package gifs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errBadMP4 = errors.New("not a readable mp4")
+
+// mp4Info reads an mp4's duration and dimensions from its movie header and
+// first video track header, without decoding any video.
+func mp4Info(data []byte) (Rendition, error) {
+	if len(data) < 8 || string(data[4:8]) != "ftyp" {
+		return Rendition{}, errBadMP4
+	}
+	moov, ok := mp4Box(data, "moov")
+	if !ok {
+		return Rendition{}, errBadMP4
+	}
+	mvhd, ok := mp4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 4 {
+		return Rendition{}, errBadMP4
+	}
+
+	r := Rendition{Format: "mp4"}
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return Rendition{}, errBadMP4
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		if len(mvhd) < 20 {
+			return Rendition{}, errBadMP4
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale > 0 {
+		r.Duration = float64(duration) / float64(timescale)
+	}
+
+	// Audio tracks have a zero size, so take the first track that doesn't.
+	for rest := moov; ; {
+		trak, next, ok := mp4NextBox(rest, "trak")
+		if !ok {
+			break
+		}
+		rest = next
+		if tkhd, ok := mp4Box(trak, "tkhd"); ok && len(tkhd) >= 8 {
+			// Width and height are 16.16 fixed point, at the very end.
+			w := binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16
+			h := binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16
+			if w > 0 && h > 0 {
+				r.Width, r.Height = int(w), int(h)
+				break
+			}
+		}
+	}
+	return r, nil
+}
+
+// mp4Box returns the body of the first box of the given type in data.
+func mp4Box(data []byte, boxType string) ([]byte, bool) {
+	body, _, ok := mp4NextBox(data, boxType)
+	return body, ok
+}
+
+// mp4NextBox returns the body of the first box of the given type in data,
+// and what follows it.
+func mp4NextBox(data []byte, boxType string) (body, rest []byte, ok bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, nil, false
+			}
+			size, header = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, nil, false
+		}
+		if string(data[4:8]) == boxType {
+			return data[header:size], data[size:], true
+		}
+		data = data[size:]
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,179 @@
+package gifs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrNoResults is returned when a search completes but nothing matches.
+	ErrNoResults = errors.New("no can haz")
+	// ErrUnsupported is returned when no provider supports an operation.
+	ErrUnsupported = errors.New("not supported by any provider")
+	// ErrBadKey is returned when a provider's api key is missing or rejected.
+	ErrBadKey = errors.New("api key missing or rejected")
+)
+
+// RateLimitError is returned when a provider's api key is over its quota.
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration // zero if the provider didn't say
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Provider + ": rate limited"
+}
+
+// UpstreamError is returned for any other unexpected status, typically a 5xx.
+type UpstreamError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: upstream responded %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// MalformedError is returned when a provider's response can't be decoded.
+type MalformedError struct {
+	Provider string
+	Err      error
+}
+
+func (e *MalformedError) Error() string {
+	return e.Provider + ": malformed response: " + e.Err.Error()
+}
+
+// Shared by all providers so that a hung upstream can't hold a request forever.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Options narrow a search.
+type Options struct {
+	Limit  int
+	Offset int
+
+	// Rating is the most mature content rating allowed, or "" for any.
+	Rating string
+}
+
+// Provider is a source of gifs.
+type Provider interface {
+	Name() string
+	Search(query string, opts Options) ([]Gif, error)
+}
+
+// Trender is a Provider that can list what's trending.
+type Trender interface {
+	Trending(opts Options) ([]Gif, error)
+}
+
+// Randomizer is a Provider that can pick a random gif, optionally limited to
+// a tag.
+type Randomizer interface {
+	Random(tag string, opts Options) (Gif, error)
+}
+
+// Getter is a Provider that can look up one of its own gifs by id. It
+// returns ErrUnsupported for other providers' gifs.
+type Getter interface {
+	Get(provider, id string, opts Options) (Gif, error)
+}
+
+// Chain is a Provider that asks each of its providers in order, returning the
+// first non-empty result set. A provider that errors is logged and skipped.
+type Chain []Provider
+
+func (c Chain) Name() string {
+	return "chain"
+}
+
+func (c Chain) Search(query string, opts Options) ([]Gif, error) {
+	return c.each(func(p Provider) ([]Gif, error) {
+		return p.Search(query, opts)
+	})
+}
+
+// each calls fn with each provider until one returns results. Providers that
+// don't support fn are skipped quietly. If none return results, each returns
+// ErrNoResults if any provider answered, otherwise the first error.
+func (c Chain) each(fn func(p Provider) ([]Gif, error)) ([]Gif, error) {
+	var firstErr error
+	answered := false
+	for _, p := range c {
+		results, err := fn(p)
+		if err == ErrUnsupported {
+			continue
+		}
+		if err != nil {
+			log.Println("ERROR:", "gifs:", p.Name()+":", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(results) > 0 {
+			return results, nil
+		}
+		answered = true
+	}
+	if answered {
+		return nil, ErrNoResults
+	}
+	if firstErr == nil {
+		return nil, ErrUnsupported
+	}
+	return nil, firstErr
+}
+
+// Trending asks each provider that can list trending gifs, in order.
+func (c Chain) Trending(opts Options) ([]Gif, error) {
+	return c.each(func(p Provider) ([]Gif, error) {
+		trender, ok := p.(Trender)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		return trender.Trending(opts)
+	})
+}
+
+// Random asks each provider that can pick a random gif, in order.
+func (c Chain) Random(tag string, opts Options) (Gif, error) {
+	results, err := c.each(func(p Provider) ([]Gif, error) {
+		randomizer, ok := p.(Randomizer)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		gif, err := randomizer.Random(tag, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []Gif{gif}, nil
+	})
+	if err != nil {
+		return Gif{}, err
+	}
+	return results[0], nil
+}
+
+// Get asks the provider the gif came from.
+func (c Chain) Get(provider, id string, opts Options) (Gif, error) {
+	results, err := c.each(func(p Provider) ([]Gif, error) {
+		getter, ok := p.(Getter)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		gif, err := getter.Get(provider, id, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []Gif{gif}, nil
+	})
+	if err != nil {
+		return Gif{}, err
+	}
+	return results[0], nil
+}
@@ -0,0 +1,124 @@
+package gifs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Content ratings, from most to least restrictive.
+var ratings = []string{"g", "pg", "pg-13", "r"}
+
+func ratingRank(rating string) int {
+	if rating == "y" { // giphy's "youth" rating is stricter than g
+		return 0
+	}
+	for i, r := range ratings {
+		if r == rating {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseRating validates a rating, returning "" for "".
+func ParseRating(rating string) (string, error) {
+	if rating == "" {
+		return "", nil
+	}
+	for _, r := range ratings {
+		if strings.EqualFold(r, rating) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown rating %q", rating)
+}
+
+// Stricter returns the more restrictive of two ratings, where "" means no
+// restriction.
+func Stricter(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" || ratingRank(a) <= ratingRank(b) {
+		return a
+	}
+	return b
+}
+
+// RatingFilter is a Provider that drops any result rated above opts.Rating,
+// for providers that ignore the rating they're asked for. Unrated results are
+// dropped unless opts.Rating allows everything.
+type RatingFilter struct {
+	Provider
+}
+
+func (f RatingFilter) Search(query string, opts Options) ([]Gif, error) {
+	results, err := f.Provider.Search(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return filterRating(results, opts.Rating)
+}
+
+func (f RatingFilter) Trending(opts Options) ([]Gif, error) {
+	trender, ok := f.Provider.(Trender)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	results, err := trender.Trending(opts)
+	if err != nil {
+		return nil, err
+	}
+	return filterRating(results, opts.Rating)
+}
+
+func (f RatingFilter) Random(tag string, opts Options) (Gif, error) {
+	randomizer, ok := f.Provider.(Randomizer)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	gif, err := randomizer.Random(tag, opts)
+	if err != nil {
+		return Gif{}, err
+	}
+	if !allowed(gif, opts.Rating) {
+		return Gif{}, ErrNoResults
+	}
+	return gif, nil
+}
+
+func (f RatingFilter) Get(provider, id string, opts Options) (Gif, error) {
+	getter, ok := f.Provider.(Getter)
+	if !ok {
+		return Gif{}, ErrUnsupported
+	}
+	gif, err := getter.Get(provider, id, opts)
+	if err != nil {
+		return Gif{}, err
+	}
+	if !allowed(gif, opts.Rating) {
+		return Gif{}, ErrNoResults
+	}
+	return gif, nil
+}
+
+func filterRating(results []Gif, rating string) ([]Gif, error) {
+	filtered := results[:0]
+	for _, gif := range results {
+		if allowed(gif, rating) {
+			filtered = append(filtered, gif)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, ErrNoResults
+	}
+	return filtered, nil
+}
+
+func allowed(gif Gif, rating string) bool {
+	if rating == "" || rating == "r" {
+		return true
+	}
+	rank := ratingRank(gif.Rating)
+	return rank >= 0 && rank <= ratingRank(rating)
+}
@@ -0,0 +1,80 @@
+package gifs
+
+import "sort"
+
+// Preferences describe what a client can play and how much it wants to
+// download. Zero values mean no limit.
+type Preferences struct {
+	MaxBytes int64
+	MaxWidth int
+
+	Video bool // can play mp4 inline
+	WebP  bool // accepts image/webp
+}
+
+// Choose returns the names of gif's renditions that fit prefs, best first:
+// formats the client prefers before gifs, then the largest that fits. If
+// nothing fits, the smallest playable rendition is returned alone.
+func (g Gif) Choose(prefs Preferences) []string {
+	var playable, fits []string
+	for name, r := range g.Renditions {
+		if formatRank(r.Format, prefs) < 0 {
+			continue
+		}
+		playable = append(playable, name)
+		if prefs.MaxBytes > 0 && r.Size > prefs.MaxBytes {
+			continue
+		}
+		if prefs.MaxWidth > 0 && r.Width > prefs.MaxWidth {
+			continue
+		}
+		fits = append(fits, name)
+	}
+
+	if len(fits) == 0 {
+		if len(playable) == 0 {
+			return nil
+		}
+		sort.Slice(playable, func(i, j int) bool {
+			a, b := g.Renditions[playable[i]], g.Renditions[playable[j]]
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+			return a.Width < b.Width
+		})
+		return playable[:1]
+	}
+
+	sort.Slice(fits, func(i, j int) bool {
+		a, b := g.Renditions[fits[i]], g.Renditions[fits[j]]
+		if ra, rb := formatRank(a.Format, prefs), formatRank(b.Format, prefs); ra != rb {
+			return ra < rb
+		}
+		if a.Width != b.Width {
+			return a.Width > b.Width
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return fits[i] < fits[j]
+	})
+	return fits
+}
+
+// formatRank orders formats by preference, or returns -1 if the client can't
+// play it.
+func formatRank(format string, prefs Preferences) int {
+	switch format {
+	case "mp4":
+		if prefs.Video {
+			return 0
+		}
+	case "webp":
+		if prefs.WebP {
+			return 1
+		}
+	case "gif":
+		return 2
+	}
+	return -1
+}
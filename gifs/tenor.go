@@ -0,0 +1,220 @@
+package gifs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How many pages' worth of positions Tenor remembers.
+const maxTenorCursors = 1000
+
+// Tenor searches the Tenor v2 api.
+type Tenor struct {
+	apiKey  string
+	baseURL string
+
+	// Tenor pages with an opaque pos token rather than an offset: each
+	// response says where the next page starts. cursors remembers those,
+	// by query and the offset they start at.
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+func NewTenor(apiKey string) *Tenor {
+	return &Tenor{apiKey: apiKey, baseURL: "https://tenor.googleapis.com/v2", cursors: map[string]string{}}
+}
+
+func (t *Tenor) Name() string {
+	return "tenor"
+}
+
+// Tenor's media format names, mapped onto the rendition names giphy uses.
+var tenorRenditions = map[string]struct{ name, format string }{
+	"gif":       {"original", "gif"},
+	"mediumgif": {"downsized", "gif"},
+	"tinygif":   {"fixed_height", "gif"},
+	"mp4":       {"original_mp4", "mp4"},
+	"tinymp4":   {"fixed_height_mp4", "mp4"},
+	"webp":      {"original_webp", "webp"},
+	"tinywebp":  {"fixed_height_webp", "webp"},
+}
+
+// Tenor doesn't rate its results; instead it filters them. Results are
+// labeled with the rating they were filtered to.
+var tenorContentFilters = map[string]string{
+	"g":     "high",
+	"pg":    "medium",
+	"pg-13": "low",
+	"r":     "off",
+}
+
+type tenorResponse struct {
+	Next    string `json:"next"`
+	Results []struct {
+		ID           string `json:"id"`
+		Title        string `json:"title"`
+		Description  string `json:"content_description"`
+		ItemURL      string `json:"itemurl"`
+		MediaFormats map[string]struct {
+			URL  string `json:"url"`
+			Dims []int  `json:"dims"`
+			Size int64  `json:"size"`
+		} `json:"media_formats"`
+	} `json:"results"`
+}
+
+func (t *Tenor) Search(query string, opts Options) ([]Gif, error) {
+	return t.get("/search", url.Values{"q": []string{query}}, opts)
+}
+
+// Trending returns tenor's featured gifs.
+func (t *Tenor) Trending(opts Options) ([]Gif, error) {
+	return t.get("/featured", url.Values{}, opts)
+}
+
+func (t *Tenor) Random(tag string, opts Options) (Gif, error) {
+	var results []Gif
+	var err error
+	if tag == "" {
+		// Tenor can only shuffle searches, so pick from what's featured.
+		results, err = t.Trending(opts)
+	} else {
+		opts.Limit, opts.Offset = 1, 0
+		results, err = t.get("/search", url.Values{"q": []string{tag}, "random": []string{"true"}}, opts)
+	}
+	if err != nil {
+		return Gif{}, err
+	}
+	if len(results) == 0 {
+		return Gif{}, ErrNoResults
+	}
+	return results[rand.Intn(len(results))], nil
+}
+
+func (t *Tenor) Get(provider, id string, opts Options) (Gif, error) {
+	if provider != t.Name() {
+		return Gif{}, ErrUnsupported
+	}
+	results, err := t.get("/posts", url.Values{"ids": []string{id}}, opts)
+	if err != nil {
+		return Gif{}, err
+	}
+	if len(results) == 0 {
+		return Gif{}, ErrNoResults
+	}
+	return results[0], nil
+}
+
+func (t *Tenor) get(path string, params url.Values, opts Options) ([]Gif, error) {
+	if t.apiKey == "" {
+		return nil, ErrBadKey
+	}
+
+	params.Set("media_filter", "gif,mediumgif,tinygif,mp4,tinymp4,webp,tinywebp")
+	rating := opts.Rating
+	if rating == "" {
+		rating = "r"
+	}
+	params.Set("contentfilter", tenorContentFilters[rating])
+
+	query := path + "?" + params.Encode()
+	if opts.Offset > 0 {
+		t.mu.Lock()
+		pos, ok := t.cursors[tenorCursor(query, opts.Offset)]
+		t.mu.Unlock()
+		if !ok {
+			// We never saw the page before it, so there's no knowing where
+			// this one starts.
+			return nil, ErrNoResults
+		}
+		params.Set("pos", pos)
+	}
+	params.Set("key", t.apiKey)
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	resp, err := httpClient.Get(t.baseURL + path + "?" + params.Encode())
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = strings.Replace(uerr.URL, t.apiKey, "REDACTED", -1)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden,
+		// Google's apis say a bad key is a bad request.
+		resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "API key"):
+		return nil, ErrBadKey
+	case resp.StatusCode == http.StatusTooManyRequests:
+		rerr := &RateLimitError{Provider: "tenor"}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			rerr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, rerr
+	default:
+		return nil, &UpstreamError{Provider: "tenor", StatusCode: resp.StatusCode, Message: strings.Replace(string(body), t.apiKey, "REDACTED", -1)}
+	}
+
+	var tenorResp tenorResponse
+	if err := json.Unmarshal(body, &tenorResp); err != nil {
+		return nil, &MalformedError{Provider: "tenor", Err: err}
+	}
+	if tenorResp.Next != "" && len(tenorResp.Results) > 0 {
+		t.mu.Lock()
+		if len(t.cursors) >= maxTenorCursors {
+			t.cursors = map[string]string{}
+		}
+		t.cursors[tenorCursor(query, opts.Offset+len(tenorResp.Results))] = tenorResp.Next
+		t.mu.Unlock()
+	}
+
+	results := make([]Gif, 0, len(tenorResp.Results))
+	for _, r := range tenorResp.Results {
+		gif := Gif{
+			ID:         r.ID,
+			Provider:   "tenor",
+			Title:      r.Title,
+			Rating:     rating,
+			PageURL:    r.ItemURL,
+			Renditions: map[string]Rendition{},
+		}
+		if gif.Title == "" {
+			gif.Title = r.Description
+		}
+		for format, media := range r.MediaFormats {
+			named, ok := tenorRenditions[format]
+			if !ok || media.URL == "" {
+				continue
+			}
+			rendition := Rendition{URL: media.URL, Format: named.format, Size: media.Size}
+			if len(media.Dims) == 2 {
+				rendition.Width, rendition.Height = media.Dims[0], media.Dims[1]
+			}
+			gif.Renditions[named.name] = rendition
+		}
+		if gif.URL() == "" {
+			continue
+		}
+		results = append(results, gif)
+	}
+	return results, nil
+}
+
+func tenorCursor(query string, offset int) string {
+	return query + "#" + strconv.Itoa(offset)
+}
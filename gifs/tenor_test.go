@@ -0,0 +1,110 @@
+package gifs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tenorPage is a page of n results, the first numbered from.
+func tenorPage(from, n int, next string) string {
+	var results []string
+	for i := from; i < from+n; i++ {
+		results = append(results, fmt.Sprintf(`{"id": "%d", "title": "sheep %d", "itemurl": "https://tenor.com/view/%d", "media_formats": {"gif": {"url": "https://media.tenor.com/%d.gif", "dims": [220, 124]}}}`, i, i, i, i))
+	}
+	return `{"next": "` + next + `", "results": [` + strings.Join(results, ",") + `]}`
+}
+
+func TestTenorPaging(t *testing.T) {
+	var mu sync.Mutex
+	var positions []string
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		pos := request.FormValue("pos")
+		mu.Lock()
+		positions = append(positions, pos)
+		mu.Unlock()
+		switch pos {
+		case "":
+			response.Write([]byte(tenorPage(0, 2, "CAgQyY3vBQ")))
+		case "CAgQyY3vBQ":
+			response.Write([]byte(tenorPage(2, 2, "CAQQ0Y3vBQ")))
+		default:
+			t.Errorf("unexpected pos %q", pos)
+		}
+	}))
+	defer server.Close()
+	tenor := NewTenor("tenorkey")
+	tenor.baseURL = server.URL
+
+	first, err := tenor.Search("sheep", Options{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tenor.Search("sheep", Options{Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(first)[0] != "0" || ids(second)[0] != "2" {
+		t.Errorf("got %v then %v", ids(first), ids(second))
+	}
+
+	// Nobody's seen what comes before these, so there's no asking for them.
+	if _, err := tenor.Search("sheep", Options{Limit: 2, Offset: 3}); err != ErrNoResults {
+		t.Errorf("unseen offset: got %v, want ErrNoResults", err)
+	}
+	if _, err := tenor.Search("goats", Options{Limit: 2, Offset: 2}); err != ErrNoResults {
+		t.Errorf("unseen query: got %v, want ErrNoResults", err)
+	}
+	if strings.Join(positions, ",") != ",CAgQyY3vBQ" {
+		t.Errorf("asked for positions %q", positions)
+	}
+}
+
+func TestTenorErrors(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if status == http.StatusTooManyRequests {
+			response.Header().Set("Retry-After", "30")
+		}
+		response.WriteHeader(status)
+		response.Write([]byte(body))
+	}))
+	defer server.Close()
+	tenor := NewTenor("tenorkey")
+	tenor.baseURL = server.URL
+
+	status, body = http.StatusBadRequest, `{"error": {"code": 400, "message": "API key not valid. Please pass a valid API key."}}`
+	if _, err := tenor.Search("sheep", Options{}); err != ErrBadKey {
+		t.Errorf("bad key: got %v", err)
+	}
+
+	status, body = http.StatusTooManyRequests, ``
+	_, err := tenor.Search("sheep", Options{})
+	if rerr, ok := err.(*RateLimitError); !ok || rerr.RetryAfter != 30*time.Second {
+		t.Errorf("429: got %#v", err)
+	}
+
+	status, body = http.StatusServiceUnavailable, `the key was tenorkey`
+	_, err = tenor.Search("sheep", Options{})
+	if uerr, ok := err.(*UpstreamError); !ok || uerr.StatusCode != 503 {
+		t.Errorf("503: got %#v", err)
+	} else if strings.Contains(uerr.Error(), "tenorkey") {
+		t.Errorf("leaked the key: %v", uerr)
+	}
+
+	status, body = http.StatusOK, `{"results": [`
+	if _, err := tenor.Search("sheep", Options{}); err == nil {
+		t.Error("malformed: expected an error")
+	} else if _, ok := err.(*MalformedError); !ok {
+		t.Errorf("malformed: got %#v", err)
+	}
+
+	if _, err := NewTenor("").Search("sheep", Options{}); err != ErrBadKey {
+		t.Errorf("no key: got %v", err)
+	}
+}
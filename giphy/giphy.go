@@ -0,0 +1,198 @@
+// Package giphy is a client for the Giphy gifs api.
+package giphy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrBadKey is returned when the api key is missing or rejected.
+	ErrBadKey = errors.New("giphy: api key missing or rejected")
+	// ErrNotFound is returned when a lookup by id, random or translate
+	// finds nothing.
+	ErrNotFound = errors.New("giphy: not found")
+)
+
+// RateLimitError is returned when the api key is over its quota.
+type RateLimitError struct {
+	RetryAfter time.Duration // zero if giphy didn't say
+}
+
+func (e *RateLimitError) Error() string {
+	return "giphy: rate limited"
+}
+
+// UpstreamError is returned for any other unexpected status, typically a 5xx.
+type UpstreamError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("giphy: upstream responded %d: %s", e.StatusCode, e.Message)
+}
+
+// MalformedError is returned when a response can't be decoded.
+type MalformedError struct {
+	Err error
+}
+
+func (e *MalformedError) Error() string {
+	return "giphy: malformed response: " + e.Err.Error()
+}
+
+const defaultBaseURL = "https://api.giphy.com/v1/gifs"
+
+// Client calls the gifs api with an api key. The key is only ever sent as a
+// query parameter, and is redacted from any error that includes a url.
+type Client struct {
+	apiKey string
+
+	// BaseURL and HTTPClient may be replaced, e.g. to point at a test server.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewClient(apiKey string) *Client {
+	return &Client{
+		apiKey:     apiKey,
+		BaseURL:    defaultBaseURL,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type SearchParams struct {
+	Query  string
+	Limit  int
+	Offset int
+	Rating string
+	Lang   string
+}
+
+type TrendingParams struct {
+	Limit  int
+	Offset int
+	Rating string
+}
+
+type RandomParams struct {
+	Tag    string
+	Rating string
+}
+
+type TranslateParams struct {
+	Phrase    string
+	Weirdness int // 0-10
+}
+
+// Search returns gifs matching a query.
+func (c *Client) Search(p SearchParams) (*ListResponse, error) {
+	params := url.Values{"q": []string{p.Query}}
+	setInt(params, "limit", p.Limit)
+	setInt(params, "offset", p.Offset)
+	setString(params, "rating", p.Rating)
+	setString(params, "lang", p.Lang)
+	var resp ListResponse
+	return &resp, c.get("/search", params, &resp)
+}
+
+// Trending returns the gifs trending on giphy now.
+func (c *Client) Trending(p TrendingParams) (*ListResponse, error) {
+	params := url.Values{}
+	setInt(params, "limit", p.Limit)
+	setInt(params, "offset", p.Offset)
+	setString(params, "rating", p.Rating)
+	var resp ListResponse
+	return &resp, c.get("/trending", params, &resp)
+}
+
+// Random returns a random gif, optionally limited to a tag.
+func (c *Client) Random(p RandomParams) (*SingleResponse, error) {
+	params := url.Values{}
+	setString(params, "tag", p.Tag)
+	setString(params, "rating", p.Rating)
+	var resp SingleResponse
+	return &resp, c.get("/random", params, &resp)
+}
+
+// Translate returns the single gif giphy thinks best matches a phrase.
+func (c *Client) Translate(p TranslateParams) (*SingleResponse, error) {
+	params := url.Values{"s": []string{p.Phrase}}
+	setInt(params, "weirdness", p.Weirdness)
+	var resp SingleResponse
+	return &resp, c.get("/translate", params, &resp)
+}
+
+// GetByID returns one gif.
+func (c *Client) GetByID(id string) (*SingleResponse, error) {
+	var resp SingleResponse
+	return &resp, c.get("/"+url.PathEscape(id), url.Values{}, &resp)
+}
+
+func (c *Client) get(path string, params url.Values, v interface{}) error {
+	if c.apiKey == "" {
+		return ErrBadKey
+	}
+	params.Set("api_key", c.apiKey)
+
+	resp, err := c.HTTPClient.Get(c.BaseURL + path + "?" + params.Encode())
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = c.redact(uerr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return ErrBadKey
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		rerr := &RateLimitError{}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			rerr.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return rerr
+	default:
+		return &UpstreamError{StatusCode: resp.StatusCode, Message: c.redact(string(body))}
+	}
+
+	if err := json.Unmarshal(body, v); err == ErrNotFound {
+		return err
+	} else if err != nil {
+		return &MalformedError{Err: err}
+	}
+	return nil
+}
+
+func (c *Client) redact(s string) string {
+	return strings.Replace(s, c.apiKey, "REDACTED", -1)
+}
+
+func setInt(params url.Values, key string, n int) {
+	if n > 0 {
+		params.Set(key, strconv.Itoa(n))
+	}
+}
+
+func setString(params url.Values, key, s string) {
+	if s != "" {
+		params.Set(key, s)
+	}
+}
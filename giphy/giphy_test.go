@@ -0,0 +1,99 @@
+package giphy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "dc6zaTOxFJmzC"
+
+// stubGiphy answers every request with status and body, and points a client
+// at it.
+func stubGiphy(t *testing.T, status int, header http.Header, body string) *Client {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if got := request.FormValue("api_key"); got != testKey {
+			t.Errorf("api_key %q", got)
+		}
+		for name, values := range header {
+			response.Header()[name] = values
+		}
+		response.WriteHeader(status)
+		response.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	c := NewClient(testKey)
+	c.BaseURL = server.URL
+	return c
+}
+
+func TestSearch(t *testing.T) {
+	c := stubGiphy(t, http.StatusOK, nil, `{"data": [{"id": "abc", "title": "counting sheep"}], "pagination": {"total_count": 1, "count": 1, "offset": 0}}`)
+	resp, err := c.Search(SearchParams{Query: "sheep"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].ID != "abc" {
+		t.Errorf("got %+v", resp.Data)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		if _, err := stubGiphy(t, status, nil, `{}`).Search(SearchParams{Query: "sheep"}); err != ErrBadKey {
+			t.Errorf("%d: got %v, want ErrBadKey", status, err)
+		}
+	}
+	if _, err := NewClient("").Search(SearchParams{Query: "sheep"}); err != ErrBadKey {
+		t.Errorf("no key: got %v, want ErrBadKey", err)
+	}
+
+	if _, err := stubGiphy(t, http.StatusNotFound, nil, `{}`).GetByID("abc"); err != ErrNotFound {
+		t.Errorf("404: got %v, want ErrNotFound", err)
+	}
+	// Random and translate say they found nothing with an empty list.
+	if _, err := stubGiphy(t, http.StatusOK, nil, `{"data": [], "meta": {"status": 200}}`).Random(RandomParams{Tag: "sheep"}); err != ErrNotFound {
+		t.Errorf("empty random: got %v, want ErrNotFound", err)
+	}
+
+	_, err := stubGiphy(t, http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}}, ``).Search(SearchParams{Query: "sheep"})
+	if rerr, ok := err.(*RateLimitError); !ok || rerr.RetryAfter != 30*time.Second {
+		t.Errorf("429: got %#v", err)
+	}
+	_, err = stubGiphy(t, http.StatusTooManyRequests, nil, ``).Search(SearchParams{Query: "sheep"})
+	if rerr, ok := err.(*RateLimitError); !ok || rerr.RetryAfter != 0 {
+		t.Errorf("429 without Retry-After: got %#v", err)
+	}
+
+	_, err = stubGiphy(t, http.StatusBadGateway, nil, `bad gateway`).Search(SearchParams{Query: "sheep"})
+	if uerr, ok := err.(*UpstreamError); !ok || uerr.StatusCode != 502 || uerr.Message != "bad gateway" {
+		t.Errorf("502: got %#v", err)
+	}
+
+	_, err = stubGiphy(t, http.StatusOK, nil, `{"data": [`).Search(SearchParams{Query: "sheep"})
+	if _, ok := err.(*MalformedError); !ok {
+		t.Errorf("malformed: got %#v", err)
+	}
+}
+
+func TestKeyStaysSecret(t *testing.T) {
+	_, err := stubGiphy(t, http.StatusInternalServerError, nil, `invalid api_key=`+testKey).Search(SearchParams{Query: "sheep"})
+	if err == nil || strings.Contains(err.Error(), testKey) {
+		t.Errorf("5xx: %v", err)
+	}
+
+	// Nothing listening: the error quotes the url, key and all.
+	c := stubGiphy(t, http.StatusOK, nil, `{}`)
+	server := httptest.NewServer(http.NotFoundHandler())
+	c.BaseURL = server.URL
+	server.Close()
+	_, err = c.Search(SearchParams{Query: "sheep"})
+	if err == nil || strings.Contains(err.Error(), testKey) {
+		t.Errorf("refused: %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "REDACTED") {
+		t.Errorf("refused: %v doesn't say the key was redacted", err)
+	}
+}
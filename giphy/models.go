@@ -0,0 +1,92 @@
+package giphy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// ListResponse is the response to search and trending.
+type ListResponse struct {
+	Data       []GIF      `json:"data"`
+	Pagination Pagination `json:"pagination"`
+	Meta       Meta       `json:"meta"`
+}
+
+// SingleResponse is the response to random, translate and get-by-id.
+type SingleResponse struct {
+	Data GIF  `json:"data"`
+	Meta Meta `json:"meta"`
+}
+
+// UnmarshalJSON returns ErrNotFound for the empty list giphy sends when
+// random or translate find nothing, rather than decoding an empty gif.
+func (r *SingleResponse) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+		Meta Meta            `json:"meta"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	r.Meta = raw.Meta
+	if d := bytes.TrimSpace(raw.Data); len(d) == 0 || d[0] != '{' {
+		return ErrNotFound
+	}
+	return json.Unmarshal(raw.Data, &r.Data)
+}
+
+type Pagination struct {
+	TotalCount int `json:"total_count"`
+	Count      int `json:"count"`
+	Offset     int `json:"offset"`
+}
+
+type Meta struct {
+	Status     int    `json:"status"`
+	Msg        string `json:"msg"`
+	ResponseID string `json:"response_id"`
+}
+
+// GIF is a gif object.
+type GIF struct {
+	Type     string           `json:"type"`
+	ID       string           `json:"id"`
+	Slug     string           `json:"slug"`
+	URL      string           `json:"url"`
+	Title    string           `json:"title"`
+	Rating   string           `json:"rating"`
+	Username string           `json:"username"`
+	Images   map[string]Image `json:"images"`
+}
+
+// Image is one rendition of a gif. Not every rendition has every format, so
+// any of URL, MP4 and WebP may be empty.
+type Image struct {
+	URL      string `json:"url"`
+	Width    Number `json:"width"`
+	Height   Number `json:"height"`
+	Frames   Number `json:"frames"`
+	Size     Number `json:"size"`
+	MP4      string `json:"mp4"`
+	MP4Size  Number `json:"mp4_size"`
+	WebP     string `json:"webp"`
+	WebPSize Number `json:"webp_size"`
+}
+
+// Number is an integer giphy may send as a string.
+type Number int64
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	s := string(bytes.Trim(b, `"`))
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*n = Number(i)
+	return nil
+}
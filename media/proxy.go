@@ -0,0 +1,337 @@
+// Package media serves gif media from our own origin, fetching each file
+// from upstream once and keeping it in a size-capped disk cache.
+package media
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/store"
+)
+
+// ErrUnknown is returned for media that was never registered with URL.
+var ErrUnknown = errors.New("media: unknown id or rendition")
+
+// How many upstream urls are remembered. Pages only link media they just
+// registered, so this only needs to outlive a page view by a comfortable margin.
+const maxSources = 10000
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Proxy maps /media/{id}/{rendition} paths onto upstream urls and caches
+// their bytes on disk, keyed by content hash. Which path is which file is kept
+// in index.json alongside them, so paths handed out before a restart still
+// work after it.
+type Proxy struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	sources map[string]*list.Element // id/rendition -> *source, oldest at back
+	order   *list.List
+	files   map[string]*list.Element // hash -> *file, least recently served at back
+	lru     *list.List
+	size    int64
+	fetches map[string]*fetch
+}
+
+type source struct {
+	key         string
+	url         string
+	hash        string
+	contentType string
+}
+
+// indexEntry is a source as saved in index.json.
+type indexEntry struct {
+	Key         string `json:"key"`
+	URL         string `json:"url"`
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+}
+
+type file struct {
+	hash string
+	size int64
+}
+
+type fetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewProxy caches up to maxBytes of media in dir, adopting any files already
+// there.
+func NewProxy(dir string, maxBytes int64) (*Proxy, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		dir:      dir,
+		maxBytes: maxBytes,
+		sources:  map[string]*list.Element{},
+		order:    list.New(),
+		files:    map[string]*list.Element{},
+		lru:      list.New(),
+		fetches:  map[string]*fetch{},
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byModTime(infos))
+	for _, info := range infos {
+		if info.IsDir() || len(info.Name()) != sha256.Size*2 {
+			continue
+		}
+		p.files[info.Name()] = p.lru.PushFront(&file{hash: info.Name(), size: info.Size()})
+		p.size += info.Size()
+	}
+	p.mu.Lock()
+	p.evict()
+	p.mu.Unlock()
+
+	// Newest first, so pushed oldest first to keep the same order.
+	var entries []indexEntry
+	if err := store.Load(p.indexPath(), &entries); err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if _, ok := p.sources[e.Key]; ok || i >= maxSources {
+			continue
+		}
+		p.sources[e.Key] = p.order.PushFront(&source{key: e.Key, url: e.URL, hash: e.Hash, contentType: e.ContentType})
+	}
+	return p, nil
+}
+
+func (p *Proxy) indexPath() string {
+	return filepath.Join(p.dir, "index.json")
+}
+
+// saveIndex saves the sources whose files are on disk. p.mu must be held.
+func (p *Proxy) saveIndex() error {
+	var entries []indexEntry
+	for el := p.order.Front(); el != nil; el = el.Next() {
+		src := el.Value.(*source)
+		if _, ok := p.files[src.hash]; !ok {
+			continue
+		}
+		entries = append(entries, indexEntry{Key: src.key, URL: src.url, Hash: src.hash, ContentType: src.contentType})
+	}
+	return store.Save(p.indexPath(), entries)
+}
+
+// URL registers upstream as the source of id's rendition and returns the
+// path it will be served from.
+func (p *Proxy) URL(id, rendition, upstream string) string {
+	key := id + "/" + rendition
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.sources[key]; ok {
+		if src := el.Value.(*source); src.url != upstream {
+			src.url, src.hash = upstream, ""
+		}
+		p.order.MoveToFront(el)
+	} else {
+		p.sources[key] = p.order.PushFront(&source{key: key, url: upstream})
+		for p.order.Len() > maxSources {
+			oldest := p.order.Back()
+			p.order.Remove(oldest)
+			delete(p.sources, oldest.Value.(*source).key)
+		}
+	}
+	return "/media/" + key
+}
+
+// Serve writes id's rendition, fetching it first if it isn't cached. Range
+// and conditional requests are handled by http.ServeContent.
+func (p *Proxy) Serve(response http.ResponseWriter, request *http.Request, id, rendition string) error {
+	src, err := p.load(id + "/" + rendition)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(p.dir, src.hash))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	response.Header().Set("Content-Type", src.contentType)
+	response.Header().Set("ETag", `"`+src.hash+`"`)
+	// Not immutable: re-registering a path with a new url changes its bytes.
+	response.Header().Set("Cache-Control", "public, max-age=31536000")
+	http.ServeContent(response, request, "", info.ModTime(), f)
+	return nil
+}
+
+// Open returns id's rendition and its content type, fetching it first if it
+// isn't cached.
+func (p *Proxy) Open(id, rendition string) (io.ReadCloser, string, error) {
+	src, err := p.load(id + "/" + rendition)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(filepath.Join(p.dir, src.hash))
+	if err != nil {
+		return nil, "", err
+	}
+	return f, src.contentType, nil
+}
+
+// load returns key's source once its bytes are on disk.
+func (p *Proxy) load(key string) (source, error) {
+	p.mu.Lock()
+	el, ok := p.sources[key]
+	if !ok {
+		p.mu.Unlock()
+		return source{}, ErrUnknown
+	}
+	src := el.Value.(*source)
+	if src.hash != "" {
+		if f, ok := p.files[src.hash]; ok {
+			p.lru.MoveToFront(f)
+			s := *src
+			p.mu.Unlock()
+			return s, nil
+		}
+	}
+	call, ok := p.fetches[key]
+	if !ok {
+		call = &fetch{done: make(chan struct{})}
+		p.fetches[key] = call
+		go func(url string) {
+			hash, contentType, err := p.download(url)
+
+			p.mu.Lock()
+			delete(p.fetches, key)
+			// The path may have been re-registered with another url meanwhile.
+			if err == nil && src.url == url {
+				src.hash, src.contentType = hash, contentType
+				if err := p.saveIndex(); err != nil {
+					log.Println("ERROR:", "media:", err.Error())
+				}
+			}
+			call.err = err
+			p.mu.Unlock()
+			close(call.done)
+		}(src.url)
+	}
+	p.mu.Unlock()
+
+	<-call.done
+	if call.err != nil {
+		return source{}, call.err
+	}
+	p.mu.Lock()
+	s := *src
+	p.mu.Unlock()
+	if s.hash == "" {
+		// What was fetched is no longer what the path points at.
+		return p.load(key)
+	}
+	return s, nil
+}
+
+// download fetches url into the cache, returning its content hash and type.
+func (p *Proxy) download(url string) (string, string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("media: %s responded %d", url, resp.StatusCode)
+	}
+
+	tmp, err := ioutil.TempFile(p.dir, "fetch-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	tmp.Close()
+	if err != nil {
+		return "", "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType, err = sniff(tmp.Name())
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.files[sum]; ok {
+		// Same bytes under another name; keep the copy we have.
+		p.lru.MoveToFront(el)
+		return sum, contentType, nil
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(p.dir, sum)); err != nil {
+		return "", "", err
+	}
+	p.files[sum] = p.lru.PushFront(&file{hash: sum, size: size})
+	p.size += size
+	p.evict()
+	return sum, contentType, nil
+}
+
+// evict removes the least recently served files until the cache fits.
+// p.mu must be held.
+func (p *Proxy) evict() {
+	for p.size > p.maxBytes && p.lru.Len() > 1 {
+		oldest := p.lru.Back()
+		f := oldest.Value.(*file)
+		if err := os.Remove(filepath.Join(p.dir, f.hash)); err != nil && !os.IsNotExist(err) {
+			log.Println("ERROR:", "media:", err.Error())
+		}
+		p.lru.Remove(oldest)
+		delete(p.files, f.hash)
+		p.size -= f.size
+	}
+}
+
+func sniff(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b := make([]byte, 512)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(b[:n]), nil
+}
+
+type byModTime []os.FileInfo
+
+func (s byModTime) Len() int           { return len(s) }
+func (s byModTime) Less(i, j int) bool { return s[i].ModTime().Before(s[j].ModTime()) }
+func (s byModTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,109 @@
+package media
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProxyRestart(t *testing.T) {
+	var fetches int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		response.Header().Set("Content-Type", "image/gif")
+		response.Write([]byte("GIF89a pretend"))
+	}))
+	defer upstream.Close()
+	dir := t.TempDir()
+
+	p, err := NewProxy(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := p.URL("abc", "original", upstream.URL+"/abc.gif"); path != "/media/abc/original" {
+		t.Errorf("path %q", path)
+	}
+	body, _, err := p.Open("abc", "original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	// A new process only has what's on disk, and nothing registered.
+	restarted, err := NewProxy(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := httptest.NewRecorder()
+	if err := restarted.Serve(response, httptest.NewRequest("GET", "/media/abc/original", nil), "abc", "original"); err != nil {
+		t.Fatal(err)
+	}
+	if got := response.Body.String(); got != "GIF89a pretend" {
+		t.Errorf("served %q", got)
+	}
+	if got := response.Header().Get("Content-Type"); got != "image/gif" {
+		t.Errorf("content type %q", got)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("fetched upstream %d times, want 1", n)
+	}
+
+	if _, _, err := restarted.Open("xyz", "original"); err != ErrUnknown {
+		t.Errorf("never registered: got %v, want ErrUnknown", err)
+	}
+	if _, err := ioutil.ReadFile(restarted.indexPath()); err != nil {
+		t.Errorf("no index: %v", err)
+	}
+}
+
+func TestProxyReregisteredDuringFetch(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/old.gif" {
+			close(started)
+			<-release
+		}
+		response.Header().Set("Content-Type", "image/gif")
+		response.Write([]byte("GIF89a " + request.URL.Path))
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.URL("abc", "original", upstream.URL+"/old.gif")
+	done := make(chan string)
+	go func() {
+		body, _, err := p.Open("abc", "original")
+		if err != nil {
+			t.Error(err)
+			done <- ""
+			return
+		}
+		b, _ := ioutil.ReadAll(body)
+		body.Close()
+		done <- string(b)
+	}()
+
+	<-started
+	p.URL("abc", "original", upstream.URL+"/new.gif")
+	close(release)
+	if got := <-done; got != "GIF89a /new.gif" {
+		t.Errorf("served %q, want the new url's bytes", got)
+	}
+
+	response := httptest.NewRecorder()
+	if err := p.Serve(response, httptest.NewRequest("GET", "/media/abc/original", nil), "abc", "original"); err != nil {
+		t.Fatal(err)
+	}
+	if got := response.Body.String(); got != "GIF89a /new.gif" {
+		t.Errorf("served %q", got)
+	}
+	if got := response.Header().Get("Cache-Control"); strings.Contains(got, "immutable") {
+		t.Errorf("cache control %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+// Package slack verifies and answers requests from a Slack app's slash
+// commands and interactive components.
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Slack's recommendation: anything older is treated as a replay.
+const maxRequestAge = 5 * time.Minute
+
+var (
+	ErrBadSignature = errors.New("slack: bad request signature")
+	ErrStale        = errors.New("slack: request timestamp too old")
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Verify checks the request's X-Slack-Signature against secret. It reads the
+// body to do so, replacing it so that the request can still be parsed.
+func Verify(request *http.Request, secret string) error {
+	body, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return err
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	timestamp := request.Header.Get("X-Slack-Request-Timestamp")
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if age := time.Since(time.Unix(secs, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return ErrStale
+	}
+
+	return checkSignature(secret, timestamp, body, request.Header.Get("X-Slack-Signature"))
+}
+
+func checkSignature(secret, timestamp string, body []byte, signature string) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Command is a slash command invocation.
+type Command struct {
+	Command     string
+	Text        string
+	UserID      string
+	ChannelID   string
+	ResponseURL string
+}
+
+// ParseCommand reads a slash command from a verified request.
+func ParseCommand(request *http.Request) Command {
+	return Command{
+		Command:     request.PostFormValue("command"),
+		Text:        request.PostFormValue("text"),
+		UserID:      request.PostFormValue("user_id"),
+		ChannelID:   request.PostFormValue("channel_id"),
+		ResponseURL: request.PostFormValue("response_url"),
+	}
+}
+
+// Interaction is a click on one of a message's buttons.
+type Interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// ParseInteraction reads the payload of an interactive component request.
+func ParseInteraction(request *http.Request) (Interaction, error) {
+	var interaction Interaction
+	err := json.Unmarshal([]byte(request.PostFormValue("payload")), &interaction)
+	return interaction, err
+}
+
+// Message is a reply to a command or interaction.
+type Message struct {
+	ResponseType    string  `json:"response_type,omitempty"`
+	Text            string  `json:"text,omitempty"`
+	Blocks          []Block `json:"blocks,omitempty"`
+	ReplaceOriginal bool    `json:"replace_original,omitempty"`
+	DeleteOriginal  bool    `json:"delete_original,omitempty"`
+}
+
+const (
+	Ephemeral = "ephemeral"
+	InChannel = "in_channel"
+)
+
+// Block is a Block Kit layout block. Only the fields the image and actions
+// blocks use are here.
+type Block struct {
+	Type     string    `json:"type"`
+	ImageURL string    `json:"image_url,omitempty"`
+	AltText  string    `json:"alt_text,omitempty"`
+	Title    *Text     `json:"title,omitempty"`
+	Elements []Element `json:"elements,omitempty"`
+}
+
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func PlainText(text string) *Text {
+	return &Text{Type: "plain_text", Text: text}
+}
+
+// Element is an interactive element. Only buttons are used.
+type Element struct {
+	Type     string `json:"type"`
+	Text     *Text  `json:"text"`
+	ActionID string `json:"action_id"`
+	Value    string `json:"value,omitempty"`
+	Style    string `json:"style,omitempty"`
+}
+
+func Button(actionID, text, value, style string) Element {
+	return Element{Type: "button", Text: PlainText(text), ActionID: actionID, Value: value, Style: style}
+}
+
+// Respond posts msg to an interaction's response url.
+func Respond(responseURL string, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("slack responded %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
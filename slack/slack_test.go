@@ -0,0 +1,144 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// Recorded from a workspace running /shoot sheep.
+const commandBody = "token=gIkuvaNzQIHg97ATvDxqgjtO&team_id=T0001&team_domain=example" +
+	"&channel_id=C2147483705&channel_name=test&user_id=U2147483697&user_name=Steve" +
+	"&command=%2Fshoot&text=sheep" +
+	"&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2F1234%2F5678" +
+	"&trigger_id=13345224609.738474920.8088930838d88f008e0&api_app_id=A123456"
+
+// Recorded from clicking Send on a preview.
+const blockActionsPayload = `{
+  "type": "block_actions",
+  "user": {"id": "U2147483697", "username": "steve", "name": "steve", "team_id": "T0001"},
+  "api_app_id": "A123456",
+  "token": "gIkuvaNzQIHg97ATvDxqgjtO",
+  "container": {"type": "message", "message_ts": "1548261231.000200", "channel_id": "C2147483705", "is_ephemeral": true},
+  "trigger_id": "12321423423.333649436676.d8c1bb837935619ccad0f624c448ffb3",
+  "team": {"id": "T0001", "domain": "example"},
+  "channel": {"id": "C2147483705", "name": "test"},
+  "response_url": "https://hooks.slack.com/actions/T0001/1234/5678",
+  "actions": [{
+    "action_id": "send",
+    "block_id": "oW0",
+    "text": {"type": "plain_text", "text": "Send", "emoji": true},
+    "value": "{\"q\":\"sheep\",\"url\":\"https://media.giphy.com/media/abc/giphy.gif\"}",
+    "style": "primary",
+    "type": "button",
+    "action_ts": "1548426417.840180"
+  }]
+}`
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func signedRequest(secret string, at time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	request := httptest.NewRequest("POST", "/slack/command", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", sign(secret, timestamp, body))
+	return request
+}
+
+func TestCheckSignature(t *testing.T) {
+	timestamp := "1531420618"
+	signature := sign(secret, timestamp, commandBody)
+
+	if err := checkSignature(secret, timestamp, []byte(commandBody), signature); err != nil {
+		t.Errorf("good signature: %v", err)
+	}
+	tampered := strings.Replace(commandBody, "text=sheep", "text=goat", 1)
+	if err := checkSignature(secret, timestamp, []byte(tampered), signature); err != ErrBadSignature {
+		t.Errorf("tampered body: got %v, want ErrBadSignature", err)
+	}
+	if err := checkSignature("not the secret", timestamp, []byte(commandBody), signature); err != ErrBadSignature {
+		t.Errorf("wrong secret: got %v, want ErrBadSignature", err)
+	}
+	if err := checkSignature(secret, "1531420619", []byte(commandBody), signature); err != ErrBadSignature {
+		t.Errorf("different timestamp: got %v, want ErrBadSignature", err)
+	}
+}
+
+func TestVerifyStale(t *testing.T) {
+	for _, age := range []time.Duration{6 * time.Minute, -6 * time.Minute} {
+		request := signedRequest(secret, time.Now().Add(-age), commandBody)
+		if err := Verify(request, secret); err != ErrStale {
+			t.Errorf("%v old: got %v, want ErrStale", age, err)
+		}
+	}
+	request := signedRequest(secret, time.Now().Add(-4*time.Minute), commandBody)
+	if err := Verify(request, secret); err != nil {
+		t.Errorf("4m old: %v", err)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	request := signedRequest(secret, time.Now(), commandBody)
+	if err := Verify(request, secret); err != nil {
+		t.Fatal(err)
+	}
+	// Verify read the body; it must still be there to parse.
+	cmd := ParseCommand(request)
+	want := Command{
+		Command:     "/shoot",
+		Text:        "sheep",
+		UserID:      "U2147483697",
+		ChannelID:   "C2147483705",
+		ResponseURL: "https://hooks.slack.com/commands/1234/5678",
+	}
+	if cmd != want {
+		t.Errorf("got %+v, want %+v", cmd, want)
+	}
+}
+
+func TestParseInteraction(t *testing.T) {
+	body := url.Values{"payload": []string{blockActionsPayload}}.Encode()
+	request := signedRequest(secret, time.Now(), body)
+	if err := Verify(request, secret); err != nil {
+		t.Fatal(err)
+	}
+	interaction, err := ParseInteraction(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interaction.Type != "block_actions" || interaction.User.ID != "U2147483697" {
+		t.Errorf("got %+v", interaction)
+	}
+	if interaction.ResponseURL != "https://hooks.slack.com/actions/T0001/1234/5678" {
+		t.Errorf("response url %q", interaction.ResponseURL)
+	}
+	if len(interaction.Actions) != 1 || interaction.Actions[0].ActionID != "send" {
+		t.Fatalf("actions %+v", interaction.Actions)
+	}
+	if want := `{"q":"sheep","url":"https://media.giphy.com/media/abc/giphy.gif"}`; interaction.Actions[0].Value != want {
+		t.Errorf("value %q, want %q", interaction.Actions[0].Value, want)
+	}
+}
+
+func TestParseInteractionMalformed(t *testing.T) {
+	body := url.Values{"payload": []string{"{not json"}}.Encode()
+	request := signedRequest(secret, time.Now(), body)
+	if _, err := ParseInteraction(request); err == nil {
+		t.Error("expected an error")
+	}
+}
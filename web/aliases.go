@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// requireAdmin guards a handler with basic auth against ADMIN_PASSWORD.
+// Without one, admin pages are off.
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		password := os.Getenv("ADMIN_PASSWORD")
+		if password == "" {
+			writeError(response, request, newError(http.StatusServiceUnavailable, "Admin isn't set up right now.", errors.New("y u no set ADMIN_PASSWORD???")))
+			return
+		}
+		_, given, ok := request.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(password)) != 1 {
+			response.Header().Set("WWW-Authenticate", `Basic realm="shoooooot admin"`)
+			writeError(response, request, newError(http.StatusUnauthorized, "Admins only", nil))
+			return
+		}
+		handler(response, request)
+	}
+}
+
+// parseRefs reads gif references, one per line or space separated, each
+// either a permalink or provider/id.
+func parseRefs(text string) ([]gifs.Ref, error) {
+	var refs []gifs.Ref
+	for _, field := range strings.Fields(text) {
+		path := field
+		if u, err := url.Parse(field); err == nil && u.Path != "" {
+			path = u.Path
+		}
+		if i := strings.Index(path, "/g/"); i >= 0 {
+			path = path[i+len("/g/"):]
+		}
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("can't make sense of " + field)
+		}
+		refs = append(refs, gifs.Ref{Provider: parts[0], ID: parts[1]})
+	}
+	return refs, nil
+}
+
+// AliasesHandler lists every alias, as json or the admin page.
+func AliasesHandler(response http.ResponseWriter, request *http.Request) {
+	if wantsJSON(request) {
+		writeJSON(response, aliases.List())
+		return
+	}
+	t, err := template.ParseFiles("aliases.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, aliases.List())
+}
+
+// AliasFormHandler saves or deletes an alias from the admin page.
+func AliasFormHandler(response http.ResponseWriter, request *http.Request) {
+	query := request.PostFormValue("query")
+	if gifs.Normalize(query) == "" {
+		writeError(response, request, newError(http.StatusBadRequest, "No query specified", nil))
+		return
+	}
+
+	var err error
+	if request.PostFormValue("action") == "delete" {
+		err = aliases.Delete(query)
+	} else {
+		refs, perr := parseRefs(request.PostFormValue("gifs"))
+		if perr != nil || len(refs) == 0 {
+			writeError(response, request, newError(http.StatusBadRequest, "Pin at least one gif, as a permalink or provider/id", perr))
+			return
+		}
+		_, err = aliases.Set(query, refs)
+	}
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	http.Redirect(response, request, "/aliases", http.StatusSeeOther)
+}
+
+// AliasHandler reads, replaces or deletes one alias as json.
+func AliasHandler(response http.ResponseWriter, request *http.Request) {
+	query := mux.Vars(request)["query"]
+	switch request.Method {
+	case "GET":
+		alias, ok := aliases.Alias(query)
+		if !ok {
+			writeError(response, request, newError(http.StatusNotFound, "No such alias", nil))
+			return
+		}
+		writeJSON(response, alias)
+	case "PUT":
+		var body struct {
+			Gifs []gifs.Ref `json:"gifs"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil || len(body.Gifs) == 0 {
+			writeError(response, request, newError(http.StatusBadRequest, `Send {"gifs": [{"provider": ..., "id": ...}]}`, err))
+			return
+		}
+		for _, ref := range body.Gifs {
+			// The same rule as provider/id in parseRefs.
+			if ref.Provider == "" || ref.ID == "" || strings.Contains(ref.Provider+ref.ID, "/") {
+				writeError(response, request, newError(http.StatusBadRequest, "Every gif needs a provider and an id", nil))
+				return
+			}
+		}
+		alias, err := aliases.Set(query, body.Gifs)
+		if err != nil {
+			writeError(response, request, err)
+			return
+		}
+		writeJSON(response, alias)
+	case "DELETE":
+		if err := aliases.Delete(query); err != nil {
+			writeError(response, request, err)
+			return
+		}
+		response.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+func TestAliasHandlerPut(t *testing.T) {
+	var err error
+	if aliases, err = gifs.NewAliases(stubProvider{}, filepath.Join(t.TempDir(), "aliases.json")); err != nil {
+		t.Fatal(err)
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/aliases/{query}", AliasHandler)
+
+	for _, test := range []struct {
+		body string
+		want int
+	}{
+		{`{"gifs": [{"provider": "giphy", "id": "abc"}]}`, http.StatusOK},
+		{`{"gifs": []}`, http.StatusBadRequest},
+		{`{"gifs": [{}]}`, http.StatusBadRequest},
+		{`{"gifs": [{"provider": "giphy"}]}`, http.StatusBadRequest},
+		{`{"gifs": [{"id": "abc"}]}`, http.StatusBadRequest},
+		{`{"gifs": [{"provider": "giphy", "id": "abc"}, {"provider": "giphy", "id": "a/b"}]}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	} {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest("PUT", "/aliases/sheep", strings.NewReader(test.body))
+		request.Header.Set("Accept", "application/json")
+		r.ServeHTTP(response, request)
+		if response.Code != test.want {
+			t.Errorf("%s: status %d, want %d", test.body, response.Code, test.want)
+		}
+	}
+
+	// Only the good one was saved.
+	alias, ok := aliases.Alias("sheep")
+	if !ok || len(alias.Gifs) != 1 || alias.Gifs[0].ID != "abc" {
+		t.Errorf("got %+v", alias)
+	}
+}
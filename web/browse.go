@@ -0,0 +1,115 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// TrendingHandler shows a page of what's trending, for when nobody has
+// anything in mind.
+func TrendingHandler(response http.ResponseWriter, request *http.Request) {
+	trender, ok := providers.(gifs.Trender)
+	if !ok {
+		writeError(response, request, gifs.ErrUnsupported)
+		return
+	}
+	opts, prefs, ok := browseOptions(response, request)
+	if !ok {
+		return
+	}
+	page := 1
+	if v := request.FormValue("page"); v != "" {
+		var err error
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			writeError(response, request, newError(http.StatusBadRequest, "page must be a positive number", err))
+			return
+		}
+	}
+	opts.Offset = (page - 1) * opts.Limit
+
+	results, err := trender.Trending(opts)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+
+	if wantsJSON(request) {
+		writeJSON(response, struct {
+			Page    int        `json:"page"`
+			Results []gifs.Gif `json:"results"`
+		}{page, results})
+		return
+	}
+
+	p := gifPage{}
+	for _, gif := range results {
+		p.Gifs = append(p.Gifs, templateMedia(gif, prefs))
+	}
+	next := url.Values{"page": []string{strconv.Itoa(page + 1)}}
+	if rating := request.FormValue("rating"); rating != "" {
+		next.Set("rating", rating)
+	}
+	p.Next = "/trending?" + next.Encode()
+	renderGifs(response, request, p)
+}
+
+// RandomHandler shows one random gif, optionally limited to a tag.
+func RandomHandler(response http.ResponseWriter, request *http.Request) {
+	randomizer, ok := providers.(gifs.Randomizer)
+	if !ok {
+		writeError(response, request, gifs.ErrUnsupported)
+		return
+	}
+	opts, prefs, ok := browseOptions(response, request)
+	if !ok {
+		return
+	}
+	tag := request.FormValue("tag")
+
+	gif, err := randomizer.Random(tag, opts)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+
+	// Every load should be a new roll.
+	response.Header().Set("Cache-Control", "no-store")
+
+	if wantsJSON(request) {
+		writeJSON(response, struct {
+			Tag    string   `json:"tag,omitempty"`
+			Result gifs.Gif `json:"result"`
+		}{tag, gif})
+		return
+	}
+	renderGifs(response, request, gifPage{Gifs: []gifMedia{templateMedia(gif, prefs)}})
+}
+
+// browseOptions reads the search options and rendition preferences, writing
+// an error and returning false if they're bad.
+func browseOptions(response http.ResponseWriter, request *http.Request) (gifs.Options, gifs.Preferences, bool) {
+	opts, err := searchOptions(request)
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "Unknown rating: "+request.FormValue("rating"), err))
+		return opts, gifs.Preferences{}, false
+	}
+	prefs, err := renditionPrefs(request)
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "max_bytes and max_width must be numbers", err))
+		return opts, prefs, false
+	}
+	return opts, prefs, true
+}
+
+func renderGifs(response http.ResponseWriter, request *http.Request, p gifPage) {
+	t, err := template.ParseFiles("gif.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, &p)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"archive/zip"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// collectionError maps collection errors onto responses.
+func collectionError(err error) error {
+	switch err {
+	case gifs.ErrNoCollection:
+		return newError(http.StatusNotFound, "No such collection", err)
+	case gifs.ErrBadCollection:
+		return newError(http.StatusBadRequest, "Collection names can only have letters, numbers, - and _", err)
+	}
+	return err
+}
+
+// CollectionsHandler lists every collection.
+func CollectionsHandler(response http.ResponseWriter, request *http.Request) {
+	list := collections.List()
+	if wantsJSON(request) {
+		writeJSON(response, list)
+		return
+	}
+	t, err := template.ParseFiles("collections.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, list)
+}
+
+// CollectionHandler shows one collection.
+func CollectionHandler(response http.ResponseWriter, request *http.Request) {
+	collection, err := collections.Collection(mux.Vars(request)["name"])
+	if err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+	if wantsJSON(request) {
+		writeJSON(response, collection)
+		return
+	}
+
+	// Thumbnails only.
+	prefs, _ := renditionPrefs(request)
+	prefs.MaxWidth = 200
+	p := struct {
+		Name string
+		Gifs []gifMedia
+	}{Name: collection.Name}
+	for _, gif := range collection.Gifs {
+		p.Gifs = append(p.Gifs, templateMedia(gif, prefs))
+	}
+	t, err := template.ParseFiles("collection.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, &p)
+}
+
+// SaveHandler adds a gif to a collection, from the save form on gif pages or
+// as json.
+func SaveHandler(response http.ResponseWriter, request *http.Request) {
+	getter, ok := providers.(gifs.Getter)
+	if !ok {
+		writeError(response, request, gifs.ErrUnsupported)
+		return
+	}
+	name := mux.Vars(request)["name"]
+	if name == "" {
+		name = request.FormValue("collection")
+	}
+	if name == "" {
+		name = "favorites"
+	}
+	gif, err := getter.Get(request.FormValue("provider"), request.FormValue("id"), defaultOptions())
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	if err := collections.Save(name, gif); err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+	if wantsJSON(request) {
+		writeJSON(response, gif)
+		return
+	}
+	http.Redirect(response, request, "/collections/"+url.PathEscape(strings.ToLower(name)), http.StatusSeeOther)
+}
+
+// RemoveHandler takes a gif out of a collection.
+func RemoveHandler(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	if err := collections.Remove(vars["name"], vars["provider"], vars["id"]); err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+	if request.Method == "DELETE" {
+		response.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(response, request, "/collections/"+url.PathEscape(vars["name"]), http.StatusSeeOther)
+}
+
+// DeleteCollectionHandler deletes a whole collection.
+func DeleteCollectionHandler(response http.ResponseWriter, request *http.Request) {
+	if err := collections.Delete(mux.Vars(request)["name"]); err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+	if request.Method == "DELETE" {
+		response.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(response, request, "/collections", http.StatusSeeOther)
+}
+
+// ShuffleHandler shows a random gif from a collection.
+func ShuffleHandler(response http.ResponseWriter, request *http.Request) {
+	gif, err := collections.Shuffle(mux.Vars(request)["name"])
+	if err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+	response.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(request) {
+		writeJSON(response, gif)
+		return
+	}
+	prefs, err := renditionPrefs(request)
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "max_bytes and max_width must be numbers", err))
+		return
+	}
+	renderGifs(response, request, gifPage{Gifs: []gifMedia{templateMedia(gif, prefs)}})
+}
+
+// ExportHandler downloads a collection as json, or with format=zip as a zip
+// of each gif's original.
+func ExportHandler(response http.ResponseWriter, request *http.Request) {
+	collection, err := collections.Collection(mux.Vars(request)["name"])
+	if err != nil {
+		writeError(response, request, collectionError(err))
+		return
+	}
+
+	if request.FormValue("format") != "zip" {
+		response.Header().Set("Content-Disposition", `attachment; filename="`+collection.Name+`.json"`)
+		writeJSON(response, collection)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/zip")
+	response.Header().Set("Content-Disposition", `attachment; filename="`+collection.Name+`.zip"`)
+	archive := zip.NewWriter(response)
+	for _, gif := range collection.Gifs {
+		if err := exportGif(archive, gif); err != nil {
+			// Too late for an error page; leave it out and carry on.
+			log.Println("ERROR:", "["+requestID(request)+"]", "export", shortID(gif)+":", err.Error())
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Println("ERROR:", "["+requestID(request)+"]", err.Error())
+	}
+}
+
+func exportGif(archive *zip.Writer, gif gifs.Gif) error {
+	body, contentType, err := openMedia(gif, "original")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	ext := ".gif"
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: shortID(gif) + ext, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/discord"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// Discord wants an answer within three seconds. Lookups slower than this are
+// deferred and the reply edited in when they finish.
+var discordDeferAfter = 2 * time.Second
+
+// DiscordInteractionHandler answers Discord's PINGs and the /shoot command.
+func DiscordInteractionHandler(response http.ResponseWriter, request *http.Request) {
+	key, err := discord.ParsePublicKey(os.Getenv("DISCORD_PUBLIC_KEY"))
+	if err != nil {
+		writeError(response, request, newError(http.StatusServiceUnavailable, "Discord isn't set up right now.", errors.New("y u no set DISCORD_PUBLIC_KEY???")))
+		return
+	}
+	request.Body = http.MaxBytesReader(response, request.Body, maxWebhookBody)
+	body, err := discord.Verify(request, key)
+	if err != nil {
+		writeError(response, request, webhookError(err))
+		return
+	}
+
+	var interaction discord.Interaction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "Malformed interaction", err))
+		return
+	}
+
+	switch interaction.Type {
+	case discord.Ping:
+		writeJSON(response, discord.Response{Type: discord.Pong})
+	case discord.ApplicationCommand:
+		query := interaction.Option("query")
+		base := baseURL(request)
+		reply := make(chan discord.Message, 1)
+		go func() {
+			reply <- discordMessage(base, interaction.UserID(), query)
+		}()
+		select {
+		case msg := <-reply:
+			writeJSON(response, discord.Response{Type: discord.ChannelMessageWithSource, Data: &msg})
+		case <-time.After(discordDeferAfter):
+			writeJSON(response, discord.Response{Type: discord.DeferredChannelMessageWithSource})
+			go func() {
+				if err := discord.EditOriginal(interaction, <-reply); err != nil {
+					log.Println("ERROR:", err.Error())
+				}
+			}()
+		}
+	default:
+		writeError(response, request, newError(http.StatusBadRequest, "Unsupported interaction type", nil))
+	}
+}
+
+// discordMessage picks a gif for the user. Our own gifs are linked from base,
+// since Discord fetches them itself.
+func discordMessage(base, userID, query string) discord.Message {
+	if query == "" {
+		return discord.Message{Content: "Usage: /shoot <query>", Flags: discord.Ephemeral}
+	}
+	results, n, err := search("discord:"+userID, query, defaultOptions())
+	if err == gifs.ErrNoResults {
+		return discord.Message{Content: "No images could be found for your query :(", Flags: discord.Ephemeral}
+	}
+	if err != nil {
+		log.Println("ERROR:", err.Error())
+		return discord.Message{Content: "An unknown error occured", Flags: discord.Ephemeral}
+	}
+	gif := results[n]
+	return discord.Message{Embeds: []discord.Embed{{
+		Title: query,
+		URL:   gif.PageURL,
+		Image: &discord.EmbedImage{URL: absoluteURL(base, gif.URL())},
+	}}}
+}
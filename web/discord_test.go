@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/discord"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+const discordCommand = `{"id":"1","type":2,"application_id":"42","token":"tok","data":{"name":"shoot","options":[{"name":"query","value":"sheep"}]},"member":{"user":{"id":"80351110224678912"}}}`
+
+// stubDiscord sets a fresh key pair up and returns a signer for requests.
+func stubDiscord(t *testing.T) func(body string) *http.Request {
+	stubSearch(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DISCORD_PUBLIC_KEY", hex.EncodeToString(public))
+	return func(body string) *http.Request {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request := httptest.NewRequest("POST", "/discord/interactions", strings.NewReader(body))
+		request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(private, []byte(timestamp+body))))
+		request.Header.Set("X-Signature-Timestamp", timestamp)
+		return request
+	}
+}
+
+func discordResponse(t *testing.T, request *http.Request) discord.Response {
+	response := httptest.NewRecorder()
+	DiscordInteractionHandler(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+	var resp discord.Response
+	if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDiscordPing(t *testing.T) {
+	sign := stubDiscord(t)
+	if resp := discordResponse(t, sign(`{"id":"1","type":1}`)); resp.Type != discord.Pong {
+		t.Errorf("got %+v, want a PONG", resp)
+	}
+
+	request := sign(`{"id":"1","type":1}`)
+	request.Header.Set("X-Signature-Ed25519", strings.Repeat("00", ed25519.SignatureSize))
+	response := httptest.NewRecorder()
+	DiscordInteractionHandler(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature: status %d, want 401", response.Code)
+	}
+}
+
+func TestDiscordCommand(t *testing.T) {
+	sign := stubDiscord(t)
+	resp := discordResponse(t, sign(discordCommand))
+	if resp.Type != discord.ChannelMessageWithSource || resp.Data == nil {
+		t.Fatalf("got %+v", resp)
+	}
+	if len(resp.Data.Embeds) != 1 || resp.Data.Embeds[0].Image.URL != "https://media.example.com/abc.gif" {
+		t.Errorf("embeds %+v", resp.Data.Embeds)
+	}
+}
+
+// slowProvider holds its answer back until gate is closed.
+type slowProvider struct {
+	stubProvider
+	gate chan struct{}
+}
+
+func (p slowProvider) Search(query string, opts gifs.Options) ([]gifs.Gif, error) {
+	<-p.gate
+	return p.stubProvider.Search(query, opts)
+}
+
+func TestDiscordDeferred(t *testing.T) {
+	sign := stubDiscord(t)
+	gate := make(chan struct{})
+	providers = slowProvider{providers.(stubProvider), gate}
+	defer func(after time.Duration) { discordDeferAfter = after }(discordDeferAfter)
+	discordDeferAfter = 10 * time.Millisecond
+
+	edits := make(chan discord.Message, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if request.Method != "PATCH" || request.URL.Path != "/webhooks/42/tok/messages/@original" {
+			t.Errorf("%s %s", request.Method, request.URL.Path)
+		}
+		var msg discord.Message
+		if err := json.NewDecoder(request.Body).Decode(&msg); err != nil {
+			t.Error(err)
+		}
+		edits <- msg
+	}))
+	defer api.Close()
+	defer func(url string) { discord.APIURL = url }(discord.APIURL)
+	discord.APIURL = api.URL
+
+	if resp := discordResponse(t, sign(discordCommand)); resp.Type != discord.DeferredChannelMessageWithSource {
+		t.Fatalf("got %+v, want a deferral", resp)
+	}
+	close(gate)
+	select {
+	case msg := <-edits:
+		if len(msg.Embeds) != 1 || msg.Embeds[0].Title != "sheep" {
+			t.Errorf("edited in %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reply was never edited in")
+	}
+}
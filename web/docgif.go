@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/docgifs"
+)
+
+// startDocGifs starts a Refresher for every channel in DOCGIF_CHANNELS. They
+// share the twitter credentials, and so one rate limit. TWITTER_API_VERSION
+// picks the api: 2 with TWITTER_BEARER_TOKEN, or 1.1 with the OAuth1
+// TWITTER_CONSUMER_* and TWITTER_ACCESS_TOKEN* credentials. Left unset, it's
+// whichever of those are set. Without any, doc gifs are off and everything
+// else carries on.
+func startDocGifs() error {
+	channels, err := docgifs.ParseChannels(os.Getenv("DOCGIF_CHANNELS"))
+	if err != nil {
+		return err
+	}
+	if docgifHistory, err = docgifs.NewHistory(filepath.Join(dataDir(), "docgifs.json"), envInt("DOCGIF_HISTORY_SIZE", 5000)); err != nil {
+		return err
+	}
+	limiter := docgifs.NewLimiter(docgifs.RateLimit, docgifs.RateLimitWindow, nil)
+	docgifChannels = map[string]*docgifs.Refresher{}
+	for _, channel := range channels {
+		refresher, err := docgifs.New(docgifs.Config{
+			APIVersion:        os.Getenv("TWITTER_API_VERSION"),
+			BearerToken:       os.Getenv("TWITTER_BEARER_TOKEN"),
+			TwitterBaseURL:    os.Getenv("TWITTER_API_URL"),
+			ConsumerKey:       os.Getenv("TWITTER_CONSUMER_KEY"),
+			ConsumerSecret:    os.Getenv("TWITTER_CONSUMER_SECRET"),
+			AccessToken:       os.Getenv("TWITTER_ACCESS_TOKEN"),
+			AccessTokenSecret: os.Getenv("TWITTER_ACCESS_TOKEN_SECRET"),
+			Account:           channel.Account,
+			Channel:           channel.Name,
+			History:           docgifHistory,
+			Caption:           channel.Caption,
+			Interval:          time.Duration(channel.Interval),
+			Limiter:           limiter,
+		})
+		if err == docgifs.ErrNoCredentials {
+			log.Println("ERROR:", "docgifs:", err.Error(), "Doc gifs are off.")
+			docgifChannels = map[string]*docgifs.Refresher{}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		docgifChannels[channel.Name] = refresher
+		go refresher.PeriodicallyRefresh()
+	}
+	defaultChannel = channels[0].Name
+	return nil
+}
+
+// docgifChannel returns the request's channel, from the path or the channel
+// param, or the default one.
+func docgifChannel(request *http.Request) (string, *docgifs.Refresher, error) {
+	name := mux.Vars(request)["channel"]
+	if name == "" {
+		name = request.FormValue("channel")
+	}
+	if name == "" {
+		name = defaultChannel
+	}
+	if len(docgifChannels) == 0 {
+		return "", nil, newError(http.StatusServiceUnavailable, "Doc gifs aren't set up right now.", docgifs.ErrNoCredentials)
+	}
+	refresher, ok := docgifChannels[name]
+	if !ok {
+		return "", nil, newError(http.StatusNotFound, "No such doc gif channel", nil)
+	}
+	return name, refresher, nil
+}
+
+// docgifView is a snapshot as kiosks get it when it changes.
+type docgifView struct {
+	Caption    string `json:"caption"`
+	SearchText string `json:"search_text"`
+	MediaURL   string `json:"media_url"`
+	TweetID    string `json:"tweet_id,omitempty"`
+	Permalink  string `json:"permalink,omitempty"`
+}
+
+func newDocgifView(snapshot docgifs.Snapshot) docgifView {
+	return docgifView{
+		Caption:    snapshot.Caption,
+		SearchText: snapshot.SearchText,
+		MediaURL:   docgifMediaURL(snapshot.GiphyURL),
+		TweetID:    snapshot.TweetID,
+		Permalink:  snapshot.Permalink,
+	}
+}
+
+// docgifETag identifies what a snapshot shows.
+func docgifETag(snapshot docgifs.Snapshot) string {
+	sum := sha1.Sum([]byte(snapshot.Caption + "|" + snapshot.SearchText + "|" + snapshot.GiphyURL))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// docgifMediaURL is where the page should load a doc gif from.
+func docgifMediaURL(giphyURL string) string {
+	sum := sha1.Sum([]byte(giphyURL))
+	return mediaURL("docgif-"+hex.EncodeToString(sum[:8]), "original", giphyURL)
+}
+
+// parseTime reads a time as RFC 3339 or unix seconds.
+func parseTime(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// DocGifHandler shows a channel's latest doc gif, or with at=<time> what it
+// was showing then.
+func DocGifHandler(response http.ResponseWriter, request *http.Request) {
+	channel, refresher, err := docgifChannel(request)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	page := struct {
+		docgifs.Snapshot
+		Channel string
+		// Live pages follow along as new gifs are tweeted.
+		Live bool
+	}{refresher.Current(), channel, true}
+	if at := request.FormValue("at"); at != "" {
+		t, err := parseTime(at)
+		if err != nil {
+			writeError(response, request, newError(http.StatusBadRequest, "at must be an RFC 3339 time or unix seconds", err))
+			return
+		}
+		var ok bool
+		if page.Snapshot, ok = refresher.At(t); !ok {
+			writeError(response, request, newError(http.StatusNotFound, "We don't remember that far back", nil))
+			return
+		}
+		page.Live = false
+	}
+	fmt.Println("docgif:", `"`+page.Caption+` `+page.SearchText+`"`, page.GiphyURL)
+
+	page.GiphyURL = docgifMediaURL(page.GiphyURL)
+
+	t, err := template.ParseFiles("docgifs/docgifs.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, page)
+}
+
+// DocGifHistoryHandler pages through doc gifs shown, newest first, with the
+// most posted gifs alongside. channel and q narrow it down.
+func DocGifHistoryHandler(response http.ResponseWriter, request *http.Request) {
+	channel, query := request.FormValue("channel"), request.FormValue("q")
+	if _, ok := docgifChannels[channel]; channel != "" && !ok {
+		writeError(response, request, newError(http.StatusNotFound, "No such doc gif channel", nil))
+		return
+	}
+	page := 1
+	if v := request.FormValue("page"); v != "" {
+		var err error
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			writeError(response, request, newError(http.StatusBadRequest, "page must be a positive number", err))
+			return
+		}
+	}
+	const perPage = 50
+	entries, total := docgifHistory.Search(channel, query, (page-1)*perPage, perPage)
+
+	p := struct {
+		Channel string          `json:"channel,omitempty"`
+		Query   string          `json:"q,omitempty"`
+		Page    int             `json:"page"`
+		Total   int             `json:"total"`
+		Entries []docgifs.Entry `json:"entries"`
+		Top     []docgifs.Stat  `json:"top"`
+		Prev    string          `json:"-"`
+		Next    string          `json:"-"`
+	}{
+		Channel: channel,
+		Query:   query,
+		Page:    page,
+		Total:   total,
+		Entries: entries,
+		Top:     docgifHistory.Top(channel, 10),
+	}
+	link := func(page int) string {
+		v := url.Values{"page": []string{strconv.Itoa(page)}}
+		if channel != "" {
+			v.Set("channel", channel)
+		}
+		if query != "" {
+			v.Set("q", query)
+		}
+		return "/docgif/history?" + v.Encode()
+	}
+	if page > 1 {
+		p.Prev = link(page - 1)
+	}
+	if page*perPage < total {
+		p.Next = link(page + 1)
+	}
+
+	if wantsJSON(request) {
+		writeJSON(response, p)
+		return
+	}
+	for i := range p.Entries {
+		p.Entries[i].MediaURL = docgifMediaURL(p.Entries[i].MediaURL)
+	}
+	for i := range p.Top {
+		p.Top[i].MediaURL = docgifMediaURL(p.Top[i].MediaURL)
+	}
+	t, err := template.ParseFiles("docgifs/history.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, &p)
+}
+
+// DocGifEventsHandler streams a channel's doc gifs as server-sent events, the
+// current one first and then each new one as it's tweeted.
+func DocGifEventsHandler(response http.ResponseWriter, request *http.Request) {
+	_, refresher, err := docgifChannel(request)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	flusher, ok := response.(http.Flusher)
+	if !ok {
+		writeError(response, request, newError(http.StatusNotImplemented, "Streaming isn't supported here", nil))
+		return
+	}
+	updates, unsubscribe := refresher.Subscribe()
+	defer unsubscribe()
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	// Don't let nginx and friends sit on events.
+	response.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(snapshot docgifs.Snapshot) error {
+		b, err := json.Marshal(newDocgifView(snapshot))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(response, "id: %s\nevent: docgif\ndata: %s\n\n", docgifETag(snapshot), b); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	if err := send(refresher.Current()); err != nil {
+		return
+	}
+
+	// Routers drop connections that go quiet, so say something every so
+	// often.
+	keepalive := time.NewTicker(20 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case snapshot := <-updates:
+			if err := send(snapshot); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(response, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+// DocGifPollHandler is the long-polling fallback for clients without
+// server-sent events. Given the ETag of what it's showing in If-None-Match,
+// it holds on until there's something new, or answers 304 after a while.
+func DocGifPollHandler(response http.ResponseWriter, request *http.Request) {
+	_, refresher, err := docgifChannel(request)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	// Subscribed before looking, so nothing slips by in between.
+	updates, unsubscribe := refresher.Subscribe()
+	defer unsubscribe()
+
+	snapshot := refresher.Current()
+	if docgifETag(snapshot) == request.Header.Get("If-None-Match") {
+		timeout := time.NewTimer(25 * time.Second)
+		defer timeout.Stop()
+		select {
+		case snapshot = <-updates:
+		case <-timeout.C:
+			response.Header().Set("ETag", docgifETag(snapshot))
+			response.WriteHeader(http.StatusNotModified)
+			return
+		case <-request.Context().Done():
+			return
+		}
+	}
+	response.Header().Set("ETag", docgifETag(snapshot))
+	response.Header().Set("Cache-Control", "no-cache")
+	writeJSON(response, newDocgifView(snapshot))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartDocGifsWithoutCredentials(t *testing.T) {
+	for _, name := range []string{"TWITTER_API_VERSION", "TWITTER_BEARER_TOKEN", "TWITTER_CONSUMER_KEY", "TWITTER_ACCESS_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("DATA_DIR", t.TempDir())
+	if err := startDocGifs(); err != nil {
+		t.Fatalf("got %v, want doc gifs turned off", err)
+	}
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/docgif":        DocGifHandler,
+		"/docgif/poll":   DocGifPollHandler,
+		"/docgif/events": DocGifEventsHandler,
+	} {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Accept", "application/json")
+		handler(response, request)
+		if response.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: status %d, want 503", path, response.Code)
+		}
+	}
+}
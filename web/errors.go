@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/giphy"
+)
+
+// httpError is an error along with the status and message to show for it.
+type httpError struct {
+	Status     int
+	Message    string
+	Err        error
+	RetryAfter int // seconds, for 429s
+}
+
+func newError(status int, msg string, err error) *httpError {
+	return &httpError{Status: status, Message: msg, Err: err}
+}
+
+func (e *httpError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error() + " " + e.Message
+	}
+	return e.Message
+}
+
+// classify works out the response for an error that isn't already an
+// httpError. Most come from searching providers.
+func classify(err error) *httpError {
+	switch e := err.(type) {
+	case *httpError:
+		return e
+	case *giphy.RateLimitError:
+		herr := newError(http.StatusTooManyRequests, "We've searched too much lately. Try again in a bit.", err)
+		herr.RetryAfter = int(e.RetryAfter.Seconds())
+		return herr
+	case *gifs.RateLimitError:
+		herr := newError(http.StatusTooManyRequests, "We've searched too much lately. Try again in a bit.", err)
+		herr.RetryAfter = int(e.RetryAfter.Seconds())
+		return herr
+	case *giphy.UpstreamError, *giphy.MalformedError, *gifs.UpstreamError, *gifs.MalformedError:
+		return newError(http.StatusBadGateway, "Our gif provider is having problems :(", err)
+	case net.Error:
+		if e.Timeout() {
+			return newError(http.StatusGatewayTimeout, "Our gif provider took too long to answer :(", err)
+		}
+		// Refused, reset, unresolvable and so on.
+		return newError(http.StatusBadGateway, "Our gif provider is having problems :(", err)
+	}
+	switch err {
+	case gifs.ErrNoResults, giphy.ErrNotFound:
+		return newError(http.StatusNotFound, "No images could be found for your query :(", err)
+	case giphy.ErrBadKey, gifs.ErrBadKey:
+		return newError(http.StatusServiceUnavailable, "Gif search isn't set up right now.", err)
+	case gifs.ErrUnsupported:
+		return newError(http.StatusServiceUnavailable, "None of our gif providers can do that right now.", err)
+	}
+	return newError(http.StatusInternalServerError, "An unknown error occured", err)
+}
+
+// writeError logs err with the request's id and renders it as a json problem
+// document or the error page, depending on what the client accepts.
+func writeError(response http.ResponseWriter, request *http.Request, err error) {
+	herr := classify(err)
+	id := requestID(request)
+	log.Println("ERROR:", "["+id+"]", herr.Status, herr.Error())
+
+	if herr.RetryAfter > 0 {
+		response.Header().Set("Retry-After", strconv.Itoa(herr.RetryAfter))
+	}
+
+	problem := struct {
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Status    int    `json:"status"`
+		Detail    string `json:"detail"`
+		RequestID string `json:"request_id"`
+	}{"about:blank", http.StatusText(herr.Status), herr.Status, herr.Message, id}
+
+	if wantsJSON(request) {
+		response.Header().Set("Content-Type", "application/problem+json")
+		response.WriteHeader(herr.Status)
+		json.NewEncoder(response).Encode(problem)
+		return
+	}
+
+	t, terr := template.ParseFiles("error.html")
+	if terr != nil {
+		log.Println("ERROR:", "["+id+"]", terr.Error())
+		http.Error(response, herr.Message+" (request "+id+")", herr.Status)
+		return
+	}
+	response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	response.WriteHeader(herr.Status)
+	t.Execute(response, problem)
+}
+
+type requestIDKey struct{}
+
+// withRequestID tags each request with an id, taken from X-Request-Id if the
+// router in front of us set one, and echoes it back in the response.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get("X-Request-Id")
+		if id == "" {
+			b := make([]byte, 8)
+			crand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		response.Header().Set("X-Request-Id", id)
+		handler.ServeHTTP(response, request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestID(request *http.Request) string {
+	id, _ := request.Context().Value(requestIDKey{}).(string)
+	return id
+}
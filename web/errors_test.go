@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/giphy"
+)
+
+func TestClassify(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "https://tenor.googleapis.com/v2/search", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	timedOut := &url.Error{Op: "Get", URL: "https://tenor.googleapis.com/v2/search", Err: context.DeadlineExceeded}
+
+	for _, test := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no results", gifs.ErrNoResults, http.StatusNotFound},
+		{"giphy not found", giphy.ErrNotFound, http.StatusNotFound},
+		{"giphy key", giphy.ErrBadKey, http.StatusServiceUnavailable},
+		{"tenor key", gifs.ErrBadKey, http.StatusServiceUnavailable},
+		{"giphy rate limit", &giphy.RateLimitError{}, http.StatusTooManyRequests},
+		{"tenor rate limit", &gifs.RateLimitError{Provider: "tenor"}, http.StatusTooManyRequests},
+		{"giphy 5xx", &giphy.UpstreamError{StatusCode: 503}, http.StatusBadGateway},
+		{"tenor 5xx", &gifs.UpstreamError{Provider: "tenor", StatusCode: 503}, http.StatusBadGateway},
+		{"tenor malformed", &gifs.MalformedError{Provider: "tenor", Err: errors.New("unexpected end of JSON input")}, http.StatusBadGateway},
+		{"refused", refused, http.StatusBadGateway},
+		{"timed out", timedOut, http.StatusGatewayTimeout},
+		{"unknown", errors.New("oops"), http.StatusInternalServerError},
+	} {
+		if got := classify(test.err).Status; got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	herr := classify(&gifs.RateLimitError{Provider: "tenor", RetryAfter: 30 * time.Second})
+	if herr.RetryAfter != 30 {
+		t.Errorf("retry after %d, want 30", herr.RetryAfter)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/media"
+)
+
+// mediaClient fetches media directly, when there's no proxy or it's only for
+// fingerprinting. Fingerprinting results fetches a lot of it, so don't wait
+// forever.
+var mediaClient = &http.Client{Timeout: 30 * time.Second}
+
+// gifPage is what gif.html renders: one or more gifs, and optionally a link
+// to more of them.
+type gifPage struct {
+	Gifs []gifMedia
+	Next string
+}
+
+// gifMedia is what a template needs to render one gif: video sources if the
+// client plays video, and an image with a srcset as the fallback.
+type gifMedia struct {
+	Provider  string
+	ID        string
+	Title     string
+	Permalink string
+	Videos    []mediaSource
+	Src       string
+	SrcSet    string
+}
+
+type mediaSource struct {
+	URL  string
+	Type string
+}
+
+// renditionPrefs works out which renditions suit the client from its
+// headers, tightened by the max_bytes and max_width parameters.
+func renditionPrefs(request *http.Request) (gifs.Preferences, error) {
+	ua := request.Header.Get("User-Agent")
+	prefs := gifs.Preferences{
+		Video: strings.Contains(ua, "Mozilla"),
+		WebP:  strings.Contains(request.Header.Get("Accept"), "image/webp"),
+	}
+	if strings.Contains(ua, "Mobi") {
+		prefs.MaxWidth = 480
+	}
+	if strings.EqualFold(request.Header.Get("Save-Data"), "on") {
+		prefs.MaxBytes = 1 << 20
+		prefs.MaxWidth = 320
+	}
+
+	if v := request.FormValue("max_bytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return prefs, err
+		}
+		if prefs.MaxBytes == 0 || n < prefs.MaxBytes {
+			prefs.MaxBytes = n
+		}
+	}
+	if v := request.FormValue("max_width"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return prefs, err
+		}
+		if prefs.MaxWidth == 0 || n < prefs.MaxWidth {
+			prefs.MaxWidth = n
+		}
+	}
+	return prefs, nil
+}
+
+// templateMedia picks gif's renditions for a client.
+func templateMedia(gif gifs.Gif, prefs gifs.Preferences) gifMedia {
+	m := gifMedia{Provider: gif.Provider, ID: gif.ID, Title: gif.Title, Permalink: permalink(gif, "")}
+	id := shortID(gif)
+	imageFormat := ""
+	var srcset []string
+	for _, name := range gif.Choose(prefs) {
+		r := gif.Renditions[name]
+		url := mediaURL(id, name, r.URL)
+		switch {
+		case r.Format == "mp4":
+			if len(m.Videos) == 0 {
+				m.Videos = append(m.Videos, mediaSource{URL: url, Type: "video/mp4"})
+			}
+		case imageFormat == "":
+			imageFormat = r.Format
+			m.Src = url
+			fallthrough
+		case r.Format == imageFormat && r.Width > 0:
+			srcset = append(srcset, url+" "+strconv.Itoa(r.Width)+"w")
+		}
+	}
+	if len(srcset) > 1 {
+		m.SrcSet = strings.Join(srcset, ", ")
+	}
+	if m.Src == "" && len(m.Videos) == 0 {
+		m.Src = mediaURL(id, "original", gif.URL())
+	}
+	return m
+}
+
+// openMedia returns the bytes of one of gif's renditions, through the proxy
+// when it's on.
+func openMedia(gif gifs.Gif, rendition string) (io.ReadCloser, string, error) {
+	r, ok := gif.Renditions[rendition]
+	if !ok {
+		return nil, "", media.ErrUnknown
+	}
+	if proxy != nil && !isLibrary(gif) {
+		proxy.URL(shortID(gif), rendition, r.URL)
+		return proxy.Open(shortID(gif), rendition)
+	}
+	return fetchMedia(gif, rendition)
+}
+
+// fetchMedia returns the bytes of one of gif's renditions from the library or
+// upstream, never the proxy. It's for media we only need to look at once, and
+// which would otherwise push what people are actually viewing out of the
+// proxy's cache.
+func fetchMedia(gif gifs.Gif, rendition string) (io.ReadCloser, string, error) {
+	r, ok := gif.Renditions[rendition]
+	if !ok {
+		return nil, "", media.ErrUnknown
+	}
+	if isLibrary(gif) {
+		ext := ".gif"
+		if r.Format == "mp4" {
+			ext = ".mp4"
+		}
+		path, ok := library.Open(gif.ID, ext)
+		if !ok {
+			return nil, "", media.ErrUnknown
+		}
+		f, err := os.Open(path)
+		return f, mime.TypeByExtension(ext), err
+	}
+	resp, err := mediaClient.Get(r.URL)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("%s responded %d", r.URL, resp.StatusCode)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func isLibrary(gif gifs.Gif) bool {
+	return library != nil && gif.Provider == library.Name()
+}
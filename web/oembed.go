@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/xml"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// oembed is an oEmbed "rich" response embedding a gif's /embed page.
+type oembed struct {
+	XMLName         xml.Name `json:"-" xml:"oembed"`
+	Version         string   `json:"version" xml:"version"`
+	Type            string   `json:"type" xml:"type"`
+	ProviderName    string   `json:"provider_name" xml:"provider_name"`
+	ProviderURL     string   `json:"provider_url" xml:"provider_url"`
+	Title           string   `json:"title,omitempty" xml:"title,omitempty"`
+	HTML            string   `json:"html" xml:"html"`
+	Width           int      `json:"width" xml:"width"`
+	Height          int      `json:"height" xml:"height"`
+	ThumbnailURL    string   `json:"thumbnail_url,omitempty" xml:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int      `json:"thumbnail_width,omitempty" xml:"thumbnail_width,omitempty"`
+	ThumbnailHeight int      `json:"thumbnail_height,omitempty" xml:"thumbnail_height,omitempty"`
+}
+
+// OEmbedHandler answers oEmbed requests for permalink urls.
+func OEmbedHandler(response http.ResponseWriter, request *http.Request) {
+	format := request.FormValue("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "xml" {
+		writeError(response, request, newError(http.StatusNotImplemented, "format must be json or xml", nil))
+		return
+	}
+
+	u, err := url.Parse(request.FormValue("url"))
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "Bad url", err))
+		return
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "g" {
+		writeError(response, request, newError(http.StatusNotFound, "That's not a gif permalink", nil))
+		return
+	}
+
+	gif, err := getGif(parts[1], parts[2], defaultOptions())
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+
+	original := gif.Renditions["original"]
+	width, height := fit(original.Width, original.Height, request.FormValue("maxwidth"), request.FormValue("maxheight"))
+	embed := baseURL(request) + "/embed/" + url.PathEscape(shortID(gif))
+	resp := oembed{
+		Version:      "1.0",
+		Type:         "rich",
+		ProviderName: "Shoooooot",
+		ProviderURL:  baseURL(request) + "/",
+		Title:        gif.Title,
+		HTML: `<iframe src="` + template.HTMLEscapeString(embed) + `" width="` + strconv.Itoa(width) +
+			`" height="` + strconv.Itoa(height) + `" frameborder="0" allowfullscreen></iframe>`,
+		Width:           width,
+		Height:          height,
+		ThumbnailURL:    absoluteURL(baseURL(request), original.URL),
+		ThumbnailWidth:  original.Width,
+		ThumbnailHeight: original.Height,
+	}
+
+	if format == "xml" {
+		response.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		response.Write([]byte(xml.Header))
+		if err := xml.NewEncoder(response).Encode(resp); err != nil {
+			writeError(response, request, err)
+		}
+		return
+	}
+	writeJSON(response, resp)
+}
+
+// fit scales width and height down to fit maxwidth and maxheight, keeping
+// the aspect ratio. Gifs without dimensions get a square default.
+func fit(width, height int, maxwidth, maxheight string) (int, int) {
+	if width <= 0 || height <= 0 {
+		width, height = 480, 480
+	}
+	if max, err := strconv.Atoi(maxwidth); err == nil && max > 0 && width > max {
+		width, height = max, height*max/width
+	}
+	if max, err := strconv.Atoi(maxheight); err == nil && max > 0 && height > max {
+		width, height = width*max/height, max
+	}
+	return width, height
+}
+
+// EmbedHandler is a bare page of just the gif, for iframes on other sites.
+func EmbedHandler(response http.ResponseWriter, request *http.Request) {
+	provider, id, ok := splitShortID(mux.Vars(request)["id"])
+	if !ok {
+		writeError(response, request, newError(http.StatusNotFound, "No such gif", nil))
+		return
+	}
+	gif, err := getGif(provider, id, defaultOptions())
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	prefs, err := renditionPrefs(request)
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "max_bytes and max_width must be numbers", err))
+		return
+	}
+
+	ancestors := os.Getenv("EMBED_FRAME_ANCESTORS")
+	if ancestors == "" {
+		ancestors = "*"
+	}
+	response.Header().Set("Content-Security-Policy", "frame-ancestors "+ancestors)
+
+	t, err := template.ParseFiles("embed.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, templateMedia(gif, prefs))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// permalink returns the canonical path of a gif, remembering the query it was
+// found with if there was one.
+func permalink(gif gifs.Gif, query string) string {
+	path := "/g/" + url.PathEscape(gif.Provider) + "/" + url.PathEscape(gif.ID)
+	if query != "" {
+		path += "?" + url.Values{"q": []string{query}}.Encode()
+	}
+	return path
+}
+
+// shortID joins a gif's provider and id into the single path segment that
+// media and embed urls use.
+func shortID(gif gifs.Gif) string {
+	return gif.Provider + "-" + gif.ID
+}
+
+func splitShortID(id string) (provider, gifID string, ok bool) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// baseURL returns the scheme and host the request was made to, trusting the
+// router in front of us about the scheme.
+func baseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// absoluteURL resolves u, which may be one of our own paths like
+// /library/<id>.gif, against base. Anything fetching it from elsewhere needs
+// the whole url.
+func absoluteURL(base, u string) string {
+	if strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") {
+		return base + u
+	}
+	return u
+}
+
+// getGif looks up one gif for a permalink. No provider owning up to it means
+// there's no such gif, same as a provider not finding it.
+func getGif(provider, id string, opts gifs.Options) (gifs.Gif, error) {
+	getter, ok := providers.(gifs.Getter)
+	if !ok {
+		return gifs.Gif{}, gifs.ErrUnsupported
+	}
+	gif, err := getter.Get(provider, id, opts)
+	if err == gifs.ErrUnsupported || err == gifs.ErrNoResults {
+		return gifs.Gif{}, newError(http.StatusNotFound, "No such gif", err)
+	}
+	return gif, err
+}
+
+// PermalinkHandler always shows the same gif, with the meta tags chat apps
+// need to unfurl it.
+func PermalinkHandler(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	opts, prefs, ok := browseOptions(response, request)
+	if !ok {
+		return
+	}
+
+	gif, err := getGif(vars["provider"], vars["id"], opts)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+
+	if wantsJSON(request) {
+		writeJSON(response, gif)
+		return
+	}
+
+	query := request.FormValue("q")
+	title := gif.Title
+	if title == "" {
+		title = query
+	}
+	original := gif.Renditions["original"]
+	canonical := baseURL(request) + permalink(gif, "")
+	oembedURL := baseURL(request) + "/oembed?" + url.Values{"url": []string{canonical}}.Encode()
+	p := struct {
+		Media       gifMedia
+		OEmbedJSON  string
+		OEmbedXML   string
+		Title       string
+		Query       string
+		Provider    string
+		Attribution string
+		URL         string
+		Image       string
+		ImageWidth  int
+		ImageHeight int
+	}{
+		Media:       templateMedia(gif, prefs),
+		OEmbedJSON:  oembedURL + "&format=json",
+		OEmbedXML:   oembedURL + "&format=xml",
+		Title:       title,
+		Query:       query,
+		Provider:    gif.Provider,
+		Attribution: gif.PageURL,
+		URL:         canonical,
+		Image:       absoluteURL(baseURL(request), original.URL),
+		ImageWidth:  original.Width,
+		ImageHeight: original.Height,
+	}
+
+	t, err := template.ParseFiles("permalink.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, &p)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+func TestPermalinksToNoSuchGif(t *testing.T) {
+	ix := gifs.NewIndex()
+	ix.Reset([]gifs.Document{{Gif: gifs.Gif{Provider: "stub", ID: "abc", Title: "sheep"}}})
+	providers = gifs.Chain{stubProvider{}, ix}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/g/{provider}/{id}", PermalinkHandler)
+	r.HandleFunc("/oembed", OEmbedHandler)
+	r.HandleFunc("/embed/{id}", EmbedHandler)
+
+	for _, path := range []string{
+		"/g/bogus/x",
+		"/g/stub/nope",
+		"/embed/bogus-x",
+		"/oembed?url=http%3A%2F%2Fexample.com%2Fg%2Fbogus%2Fx&format=json",
+	} {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Accept", "application/json")
+		r.ServeHTTP(response, request)
+		if response.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, response.Code)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/slack"
+)
+
+// Slack and Discord payloads are small; anything bigger isn't from them.
+const maxWebhookBody = 1 << 20
+
+// slackChoice is carried in the preview's button values, so that the
+// interaction knows what was previewed.
+type slackChoice struct {
+	Query string `json:"q"`
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+// verifySlack writes an error and returns false unless the request was
+// signed with SLACK_SIGNING_SECRET.
+func verifySlack(response http.ResponseWriter, request *http.Request) bool {
+	secret := os.Getenv("SLACK_SIGNING_SECRET")
+	if secret == "" {
+		writeError(response, request, newError(http.StatusServiceUnavailable, "Slack isn't set up right now.", errors.New("y u no set SLACK_SIGNING_SECRET???")))
+		return false
+	}
+	request.Body = http.MaxBytesReader(response, request.Body, maxWebhookBody)
+	if err := slack.Verify(request, secret); err != nil {
+		writeError(response, request, webhookError(err))
+		return false
+	}
+	return true
+}
+
+// webhookError maps a failed verification onto a response.
+func webhookError(err error) error {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		return newError(http.StatusRequestEntityTooLarge, "Request too large", err)
+	}
+	return newError(http.StatusUnauthorized, "Bad signature", err)
+}
+
+// SlackCommandHandler answers the /shoot slash command with a preview only
+// the caller can see. Searches can take longer than the three seconds Slack
+// waits, so the command is acknowledged straight away and the preview posted
+// to the response url when it's ready.
+func SlackCommandHandler(response http.ResponseWriter, request *http.Request) {
+	if !verifySlack(response, request) {
+		return
+	}
+	cmd := slack.ParseCommand(request)
+	query := strings.TrimSpace(cmd.Text)
+	if query == "" {
+		writeJSON(response, slack.Message{ResponseType: slack.Ephemeral, Text: "Usage: " + cmd.Command + " <query>"})
+		return
+	}
+	base := baseURL(request)
+	go func() {
+		if err := slack.Respond(cmd.ResponseURL, slackPreview(base, cmd.UserID, query)); err != nil {
+			log.Println("ERROR:", err.Error())
+		}
+	}()
+}
+
+// SlackInteractionHandler handles the preview's Send, Shuffle and Cancel
+// buttons. Slack ignores the response body for these, so it answers through
+// the response url instead.
+func SlackInteractionHandler(response http.ResponseWriter, request *http.Request) {
+	if !verifySlack(response, request) {
+		return
+	}
+	interaction, err := slack.ParseInteraction(request)
+	if err != nil || len(interaction.Actions) < 1 {
+		writeError(response, request, newError(http.StatusBadRequest, "Malformed payload", err))
+		return
+	}
+	action := interaction.Actions[0]
+	var choice slackChoice
+	if action.Value != "" {
+		if err := json.Unmarshal([]byte(action.Value), &choice); err != nil {
+			writeError(response, request, newError(http.StatusBadRequest, "Malformed action value", err))
+			return
+		}
+	}
+
+	base := baseURL(request)
+	go func() {
+		var err error
+		switch action.ActionID {
+		case "send":
+			err = slack.Respond(interaction.ResponseURL, slack.Message{
+				ResponseType: slack.InChannel,
+				Text:         "<@" + interaction.User.ID + ">: " + choice.Query,
+				Blocks:       []slack.Block{slackImage(choice)},
+			})
+			if err == nil {
+				err = slack.Respond(interaction.ResponseURL, slack.Message{DeleteOriginal: true})
+			}
+		case "shuffle":
+			msg := slackPreview(base, interaction.User.ID, choice.Query)
+			msg.ReplaceOriginal = true
+			err = slack.Respond(interaction.ResponseURL, msg)
+		case "cancel":
+			err = slack.Respond(interaction.ResponseURL, slack.Message{DeleteOriginal: true})
+		default:
+			err = errors.New("unknown slack action " + action.ActionID)
+		}
+		if err != nil {
+			log.Println("ERROR:", err.Error())
+		}
+	}()
+}
+
+// slackPreview picks a gif for the user and offers it back with buttons. Our
+// own gifs are linked from base, since Slack fetches them itself.
+func slackPreview(base, userID, query string) slack.Message {
+	results, n, err := search("slack:"+userID, query, defaultOptions())
+	if err == gifs.ErrNoResults {
+		return slack.Message{ResponseType: slack.Ephemeral, Text: "No images could be found for your query :("}
+	}
+	if err != nil {
+		log.Println("ERROR:", err.Error())
+		return slack.Message{ResponseType: slack.Ephemeral, Text: "An unknown error occured"}
+	}
+
+	choice := slackChoice{Query: query, URL: absoluteURL(base, results[n].URL()), Title: results[n].Title}
+	value, _ := json.Marshal(choice)
+	return slack.Message{
+		ResponseType: slack.Ephemeral,
+		Text:         query,
+		Blocks: []slack.Block{
+			slackImage(choice),
+			{Type: "actions", Elements: []slack.Element{
+				slack.Button("send", "Send", string(value), "primary"),
+				slack.Button("shuffle", "Shuffle", string(value), ""),
+				slack.Button("cancel", "Cancel", "", ""),
+			}},
+		},
+	}
+}
+
+func slackImage(choice slackChoice) slack.Block {
+	alt := choice.Title
+	if alt == "" {
+		alt = choice.Query
+	}
+	return slack.Block{Type: "image", ImageURL: choice.URL, AltText: alt, Title: slack.PlainText(choice.Query)}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/slack"
+)
+
+const slackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// stubProvider answers every search with the same gifs.
+type stubProvider []gifs.Gif
+
+func (p stubProvider) Name() string {
+	return "stub"
+}
+
+func (p stubProvider) Search(query string, opts gifs.Options) ([]gifs.Gif, error) {
+	if opts.Offset > 0 {
+		return nil, gifs.ErrNoResults
+	}
+	return p, nil
+}
+
+func stubSearch(t *testing.T) {
+	providers = stubProvider{{
+		ID:       "abc",
+		Provider: "stub",
+		Title:    "counting sheep",
+		Rating:   "g",
+		Renditions: map[string]gifs.Rendition{
+			"original": {URL: "https://media.example.com/abc.gif", Format: "gif"},
+		},
+	}}
+	history = gifs.NewHistory(100, time.Hour)
+	maxRating = ""
+	t.Setenv("SLACK_SIGNING_SECRET", slackSecret)
+}
+
+// slackResponses stands in for Slack's response urls, passing on whatever is
+// posted to them.
+func slackResponses(t *testing.T) (*httptest.Server, chan slack.Message) {
+	messages := make(chan slack.Message, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var msg slack.Message
+		if err := json.NewDecoder(request.Body).Decode(&msg); err != nil {
+			t.Errorf("response url got %v", err)
+		}
+		messages <- msg
+	}))
+	t.Cleanup(server.Close)
+	return server, messages
+}
+
+func nextMessage(t *testing.T, messages chan slack.Message) slack.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing posted to the response url")
+		return slack.Message{}
+	}
+}
+
+func signedSlackRequest(path string, form url.Values) *http.Request {
+	body := form.Encode()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(slackSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+	request := httptest.NewRequest("POST", path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return request
+}
+
+func TestSlackCommandHandler(t *testing.T) {
+	stubSearch(t)
+	server, messages := slackResponses(t)
+
+	request := signedSlackRequest("/slack/command", url.Values{
+		"command":      {"/shoot"},
+		"text":         {"sheep"},
+		"user_id":      {"U2147483697"},
+		"channel_id":   {"C2147483705"},
+		"response_url": {server.URL + "/commands/1234/5678"},
+	})
+	response := httptest.NewRecorder()
+	SlackCommandHandler(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+
+	msg := nextMessage(t, messages)
+	if msg.ResponseType != slack.Ephemeral {
+		t.Errorf("response type %q", msg.ResponseType)
+	}
+	if len(msg.Blocks) != 2 || msg.Blocks[0].ImageURL != "https://media.example.com/abc.gif" {
+		t.Fatalf("blocks %+v", msg.Blocks)
+	}
+	var actions []string
+	for _, element := range msg.Blocks[1].Elements {
+		actions = append(actions, element.ActionID)
+	}
+	if strings.Join(actions, ",") != "send,shuffle,cancel" {
+		t.Errorf("actions %v", actions)
+	}
+}
+
+func TestSlackCommandHandlerBadSignature(t *testing.T) {
+	stubSearch(t)
+	request := signedSlackRequest("/slack/command", url.Values{"text": {"sheep"}})
+	request.Header.Set("X-Slack-Signature", "v0=00")
+	response := httptest.NewRecorder()
+	SlackCommandHandler(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401", response.Code)
+	}
+}
+
+func TestSlackInteractionHandlerSend(t *testing.T) {
+	stubSearch(t)
+	server, messages := slackResponses(t)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U2147483697"},
+		"response_url": server.URL + "/actions/T0001/1234/5678",
+		"actions": []map[string]string{{
+			"action_id": "send",
+			"value":     `{"q":"sheep","url":"https://media.example.com/abc.gif"}`,
+		}},
+	})
+	request := signedSlackRequest("/slack/interactions", url.Values{"payload": {string(payload)}})
+	response := httptest.NewRecorder()
+	SlackInteractionHandler(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+
+	sent := nextMessage(t, messages)
+	if sent.ResponseType != slack.InChannel || sent.Text != "<@U2147483697>: sheep" {
+		t.Errorf("sent %+v", sent)
+	}
+	if len(sent.Blocks) != 1 || sent.Blocks[0].ImageURL != "https://media.example.com/abc.gif" {
+		t.Errorf("sent blocks %+v", sent.Blocks)
+	}
+	if cleanup := nextMessage(t, messages); !cleanup.DeleteOriginal {
+		t.Errorf("preview wasn't deleted: %+v", cleanup)
+	}
+}
+
+func TestSlackInteractionHandlerMalformed(t *testing.T) {
+	stubSearch(t)
+	request := signedSlackRequest("/slack/interactions", url.Values{"payload": {"{}"}})
+	response := httptest.NewRecorder()
+	SlackInteractionHandler(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", response.Code)
+	}
+}
+
+func TestSlackCommandHandlerLibraryGif(t *testing.T) {
+	stubSearch(t)
+	providers = stubProvider{{
+		ID:         "0123456789abcdef",
+		Provider:   "library",
+		Renditions: map[string]gifs.Rendition{"original": {URL: "/library/0123456789abcdef.gif", Format: "gif"}},
+	}}
+	server, messages := slackResponses(t)
+
+	request := signedSlackRequest("/slack/command", url.Values{
+		"command":      {"/shoot"},
+		"text":         {"sheep"},
+		"response_url": {server.URL + "/commands/1234/5678"},
+	})
+	request.Host = "shoot.example.com"
+	request.Header.Set("X-Forwarded-Proto", "https")
+	SlackCommandHandler(httptest.NewRecorder(), request)
+
+	// Slack fetches the image itself, so it needs the whole url.
+	msg := nextMessage(t, messages)
+	if len(msg.Blocks) < 1 || msg.Blocks[0].ImageURL != "https://shoot.example.com/library/0123456789abcdef.gif" {
+		t.Errorf("blocks %+v", msg.Blocks)
+	}
+}
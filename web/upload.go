@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kevin-cantwell/kvn/gifs"
+)
+
+// uploadError maps library upload errors onto responses.
+func uploadError(err error) error {
+	switch err {
+	case gifs.ErrBadUpload:
+		return newError(http.StatusUnsupportedMediaType, "Only gifs and mp4s, please", err)
+	case gifs.ErrCorruptUpload:
+		return newError(http.StatusBadRequest, "That file looks corrupt :(", err)
+	case gifs.ErrUploadTooBig:
+		return newError(http.StatusRequestEntityTooLarge, "That gif is too big :(", err)
+	}
+	return err
+}
+
+// UploadFormHandler shows the upload form.
+func UploadFormHandler(response http.ResponseWriter, request *http.Request) {
+	t, err := template.ParseFiles("upload.html")
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+	t.Execute(response, struct{ MaxMB int }{envInt("UPLOAD_MAX_MB", 10)})
+}
+
+// UploadHandler adds a gif or mp4 to the local library from a multipart form
+// with the file in "file" and optional "title", "tags" and "rating" fields.
+func UploadHandler(response http.ResponseWriter, request *http.Request) {
+	if library == nil {
+		writeError(response, request, newError(http.StatusServiceUnavailable, "There's no library to upload to.", errors.New("y u no set LIBRARY_DIR???")))
+		return
+	}
+	maxBytes := int64(envInt("UPLOAD_MAX_MB", 10)) << 20
+	tooBig := newError(http.StatusRequestEntityTooLarge, "Uploads can be at most "+strconv.Itoa(envInt("UPLOAD_MAX_MB", 10))+"MB", nil)
+
+	// Leave a little room for the rest of the form.
+	request.Body = http.MaxBytesReader(response, request.Body, maxBytes+1<<20)
+	if err := request.ParseMultipartForm(32 << 20); err != nil {
+		if request.ContentLength > maxBytes {
+			writeError(response, request, tooBig)
+			return
+		}
+		writeError(response, request, newError(http.StatusBadRequest, "Send the file as multipart/form-data", err))
+		return
+	}
+	defer request.MultipartForm.RemoveAll()
+	file, header, err := request.FormFile("file")
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "No file uploaded", err))
+		return
+	}
+	defer file.Close()
+	if header.Size > maxBytes {
+		writeError(response, request, tooBig)
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		writeError(response, request, err)
+		return
+	}
+
+	rating, err := gifs.ParseRating(request.FormValue("rating"))
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadRequest, "rating must be one of g, pg, pg-13 or r", err))
+		return
+	}
+	// Files are stored by hash, so the name they were uploaded with is the
+	// next best title.
+	title := strings.TrimSpace(request.FormValue("title"))
+	if title == "" {
+		title = strings.NewReplacer("-", " ", "_", " ").Replace(strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename)))
+	}
+	gif, err := library.Add(data, gifs.Sidecar{
+		Title:  title,
+		Tags:   strings.FieldsFunc(request.FormValue("tags"), func(r rune) bool { return r == ',' }),
+		Rating: rating,
+	})
+	if err != nil {
+		writeError(response, request, uploadError(err))
+		return
+	}
+	// Searchable straight away, rather than whenever the index next rebuilds.
+	index.Rebuild()
+
+	if wantsJSON(request) {
+		response.Header().Set("Location", permalink(gif, ""))
+		response.Header().Set("Content-Type", "application/json")
+		response.WriteHeader(http.StatusCreated)
+		writeJSON(response, gif)
+		return
+	}
+	http.Redirect(response, request, permalink(gif, ""), http.StatusSeeOther)
+}
@@ -1,57 +1,252 @@
 package main
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/kevin-cantwell/kvn/docgifs"
-	jsn "github.com/timehop/goth/json"
+	"github.com/kevin-cantwell/kvn/gifs"
+	"github.com/kevin-cantwell/kvn/media"
 )
 
+// aliases pins team in-jokes to specific gifs. It's consulted before any
+// provider is searched.
+var aliases *gifs.Aliases
+
+// collections are named sets of saved gifs.
+var collections *gifs.Collections
+
+// history remembers what each session has been shown for a query, so that
+// "Try again" doesn't repeat itself.
+var history *gifs.History
+
+// library is the local gif library in LIBRARY_DIR, or nil if there isn't
+// one. It's searched as the "local" provider.
+var library *gifs.Library
+
+// index full-text searches every gif we already know about: saved, cached
+// and in the library. It's the last resort when the providers come up empty
+// or can't be reached.
+var index *gifs.Index
+
+// proxy serves gif media from our own origin when MEDIA_PROXY is set, and
+// is nil otherwise.
+var proxy *media.Proxy
+
+// maxRating is the most mature content any request may see, from
+// GIF_MAX_RATING. Requests can only tighten it.
+var maxRating string
+
+// docgifChannels follow the latest gifs tweeted by their accounts, by channel
+// name. /docgif shows defaultChannel.
+var (
+	docgifChannels map[string]*docgifs.Refresher
+	defaultChannel string
+)
+
+// docgifHistory records every doc gif shown, on every channel.
+var docgifHistory *docgifs.History
+
+// providers is what GifHandler searches: aliases, then collections, then
+// the cached fallback chain in GIF_PROVIDERS order, then the index.
+var providers gifs.Provider
+
 func main() {
-	go docgifs.PeriodicallyRefresh()
+	if err := startDocGifs(); err != nil {
+		log.Fatalln("docgifs:", err)
+	}
+
+	var err error
+	if maxRating, err = gifs.ParseRating(os.Getenv("GIF_MAX_RATING")); err != nil {
+		log.Fatalln("GIF_MAX_RATING:", err)
+	}
+
+	if dir := os.Getenv("LIBRARY_DIR"); dir != "" {
+		if library, err = gifs.NewLibrary(dir, "/library/"); err != nil {
+			log.Fatalln("library:", err)
+		}
+		go library.Watch(envDuration("LIBRARY_REFRESH", 30*time.Second))
+	}
+
+	upstream := gifs.RatingFilter{Provider: newProviders(os.Getenv("GIF_PROVIDERS"))}
+	cache := gifs.NewCache(upstream, envInt("GIF_CACHE_SIZE", 512), envDuration("GIF_CACHE_TTL", 10*time.Minute))
+	// Hit and miss counters are served with the other expvars at /debug/vars.
+	expvar.Publish("gif_cache", expvar.Func(func() interface{} { return cache.Stats() }))
+	var cached gifs.Provider = cache
+	if workers := envInt("GIF_DEDUPE_WORKERS", 8); workers > 0 {
+		// Deduped after caching, so that a page cached before its media was
+		// all fingerprinted is deduped properly next time. Fingerprints are
+		// remembered by gif, so they're still only worked out once.
+		cached = gifs.NewDedupe(cache, func(gif gifs.Gif, rendition string) (io.ReadCloser, error) {
+			body, _, err := fetchMedia(gif, rendition)
+			return body, err
+		}, workers, envInt("GIF_DEDUPE_SIZE", 10000), envDuration("GIF_DEDUPE_WAIT", 2*time.Second))
+	}
+	if collections, err = gifs.NewCollections(filepath.Join(dataDir(), "collections.json")); err != nil {
+		log.Fatalln("collections:", err)
+	}
+	sources := []gifs.Indexable{collections, cache}
+	if library != nil {
+		sources = append(sources, library)
+	}
+	index = gifs.NewIndex(sources...)
+	go index.Watch(envDuration("GIF_INDEX_REFRESH", time.Minute))
+	// Collections come first, outside the cache, so that saved gifs show up
+	// straight away.
+	chain := gifs.Chain{collections, cached, index}
+	if aliases, err = gifs.NewAliases(chain, filepath.Join(dataDir(), "aliases.json")); err != nil {
+		log.Fatalln("aliases:", err)
+	}
+	providers = aliases
+
+	history = gifs.NewHistory(envInt("GIF_HISTORY_SIZE", 10000), envDuration("GIF_HISTORY_TTL", time.Hour))
+
+	if os.Getenv("MEDIA_PROXY") != "" {
+		dir := os.Getenv("MEDIA_CACHE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "kvn-media")
+		}
+		if proxy, err = media.NewProxy(dir, int64(envInt("MEDIA_CACHE_MB", 512))<<20); err != nil {
+			log.Fatalln("media proxy:", err)
+		}
+	}
 
 	rand.Seed(time.Now().Unix())
 
 	r := mux.NewRouter()
 	r.HandleFunc("/", IndexHandler)
 	r.HandleFunc("/image", GifHandler)
+	r.HandleFunc("/trending", TrendingHandler)
+	r.HandleFunc("/random", RandomHandler)
+	r.HandleFunc("/g/{provider}/{id}", PermalinkHandler)
+	r.HandleFunc("/oembed", OEmbedHandler)
+	r.HandleFunc("/embed/{id}", EmbedHandler)
+	r.HandleFunc("/collections", CollectionsHandler).Methods("GET")
+	r.HandleFunc("/collections", SaveHandler).Methods("POST")
+	r.HandleFunc("/collections/{name}", CollectionHandler).Methods("GET")
+	r.HandleFunc("/collections/{name}", DeleteCollectionHandler).Methods("DELETE")
+	r.HandleFunc("/collections/{name}/delete", DeleteCollectionHandler).Methods("POST")
+	r.HandleFunc("/collections/{name}/gifs", SaveHandler).Methods("POST")
+	r.HandleFunc("/collections/{name}/gifs/{provider}/{id}", RemoveHandler).Methods("DELETE")
+	r.HandleFunc("/collections/{name}/gifs/{provider}/{id}/delete", RemoveHandler).Methods("POST")
+	r.HandleFunc("/collections/{name}/shuffle", ShuffleHandler).Methods("GET")
+	r.HandleFunc("/collections/{name}/export", ExportHandler).Methods("GET")
+	r.HandleFunc("/aliases", requireAdmin(AliasesHandler)).Methods("GET")
+	r.HandleFunc("/aliases", requireAdmin(AliasFormHandler)).Methods("POST")
+	r.HandleFunc("/aliases/{query}", requireAdmin(AliasHandler)).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/upload", requireAdmin(UploadFormHandler)).Methods("GET")
+	r.HandleFunc("/upload", requireAdmin(UploadHandler)).Methods("POST")
 	r.HandleFunc("/slimemold", SlimeMoldHandler)
 	r.HandleFunc("/slimemold/{asset}", SlimeMoldAssetHandler)
 	r.HandleFunc("/docgif", DocGifHandler)
+	r.HandleFunc("/docgif/history", DocGifHistoryHandler)
+	r.HandleFunc("/docgif/events", DocGifEventsHandler)
+	r.HandleFunc("/docgif/poll", DocGifPollHandler)
+	r.HandleFunc("/docgif/{channel}", DocGifHandler)
+	r.HandleFunc("/media/{id}/{rendition}", MediaHandler)
+	r.HandleFunc("/library/{file}", LibraryHandler)
 	r.HandleFunc("/hotwaterbling", HotwaterBlingHandler)
-	http.Handle("/", r)
+	r.HandleFunc("/slack/command", SlackCommandHandler).Methods("POST")
+	r.HandleFunc("/slack/interactions", SlackInteractionHandler).Methods("POST")
+	r.HandleFunc("/discord/interactions", DiscordInteractionHandler).Methods("POST")
+	http.Handle("/", withRequestID(r))
 	log.Println("http://localhost:" + os.Getenv("PORT"))
 	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
 		panic(err)
 	}
 }
 
-func writeError(response http.ResponseWriter, err error, msg string) {
-	response.WriteHeader(http.StatusInternalServerError)
-	if err != nil {
-		log.Println("ERROR:", err.Error(), msg)
-	} else {
-		log.Println("ERROR:", msg)
+// newProviders builds the provider chain from a comma separated list of
+// provider names. Defaults to giphy, falling back to tenor.
+func newProviders(order string) gifs.Chain {
+	if order == "" {
+		order = "giphy,tenor"
+	}
+	var chain gifs.Chain
+	for _, name := range strings.Split(order, ",") {
+		switch strings.TrimSpace(name) {
+		case "giphy":
+			chain = append(chain, gifs.NewGiphy(os.Getenv("GIPHY_API_KEY")))
+		case "tenor":
+			chain = append(chain, gifs.NewTenor(os.Getenv("TENOR_API_KEY")))
+		case "local":
+			if library == nil {
+				log.Println("ERROR:", "local gif provider needs LIBRARY_DIR")
+				continue
+			}
+			chain = append(chain, library)
+		default:
+			log.Println("ERROR:", "unknown gif provider:", name)
+		}
+	}
+	return chain
+}
+
+// dataDir is where state that should survive a restart is kept.
+func dataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "data"
+}
+
+func envInt(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+		log.Println("ERROR:", key+":", err.Error())
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+		log.Println("ERROR:", key+":", err.Error())
+	}
+	return def
+}
+
+// wantsJSON reports whether the client asked for json, either with
+// ?format=json or an Accept header.
+func wantsJSON(request *http.Request) bool {
+	if request.FormValue("format") == "json" {
+		return true
+	}
+	accept := request.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "+json")
+}
+
+func writeJSON(response http.ResponseWriter, v interface{}) {
+	response.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(response).Encode(v); err != nil {
+		log.Println("ERROR:", err.Error())
 	}
-	response.Write([]byte(msg))
 }
 
 func IndexHandler(response http.ResponseWriter, request *http.Request) {
 	t, err := template.ParseFiles("index.html")
 	if err != nil {
-		writeError(response, err, "An unknown error occured")
+		writeError(response, request, err)
 		return
 	}
 	t.Execute(response, nil)
@@ -60,7 +255,7 @@ func IndexHandler(response http.ResponseWriter, request *http.Request) {
 func SlimeMoldHandler(response http.ResponseWriter, request *http.Request) {
 	t, err := template.ParseFiles("slimemold/slime_mold.html")
 	if err != nil {
-		writeError(response, err, "An unknown error occured")
+		writeError(response, request, err)
 		return
 	}
 	t.Execute(response, nil)
@@ -71,94 +266,127 @@ func SlimeMoldAssetHandler(response http.ResponseWriter, request *http.Request)
 	http.ServeFile(response, request, filepath.Join("slimemold", asset))
 }
 
-func DocGifHandler(response http.ResponseWriter, request *http.Request) {
-	page := docgifs.CurrentPage()
-	fmt.Println("docgif:", `"doc gif `+page.SearchText+`"`, page.GiphyURL)
+// sessionID returns the id in the request's session cookie, setting a new one
+// if there isn't one.
+func sessionID(response http.ResponseWriter, request *http.Request) string {
+	if cookie, err := request.Cookie("session"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		log.Println("ERROR:", err.Error())
+	}
+	id := hex.EncodeToString(b)
+	http.SetCookie(response, &http.Cookie{Name: "session", Value: id, Path: "/", HttpOnly: true})
+	return id
+}
 
-	t, err := template.ParseFiles("docgifs/docgifs.html")
+// searchOptions reads the search options a request may set.
+func searchOptions(request *http.Request) (gifs.Options, error) {
+	rating, err := gifs.ParseRating(request.FormValue("rating"))
 	if err != nil {
-		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return gifs.Options{}, err
+	}
+	opts := defaultOptions()
+	opts.Rating = gifs.Stricter(opts.Rating, rating)
+	return opts, nil
+}
+
+func defaultOptions() gifs.Options {
+	return gifs.Options{Limit: 25, Rating: maxRating}
+}
+
+// search picks a gif for query that hasn't been shown to key (a session or
+// chat user) before. Everything that serves gifs goes through here.
+func search(key, query string, opts gifs.Options) ([]gifs.Gif, int, error) {
+	return history.Pick(key+"|"+gifs.Normalize(query), opts.Limit, func(offset int) ([]gifs.Gif, error) {
+		opts.Offset = offset
+		return providers.Search(query, opts)
+	})
+}
+
+// mediaURL returns the url templates should use for a piece of media: the
+// proxied path in proxy mode, otherwise upstream itself. Media we already
+// serve ourselves is never proxied.
+func mediaURL(id, rendition, upstream string) string {
+	if proxy == nil || strings.HasPrefix(upstream, "/") {
+		return upstream
+	}
+	return proxy.URL(id, rendition, upstream)
+}
+
+func MediaHandler(response http.ResponseWriter, request *http.Request) {
+	if proxy == nil {
+		writeError(response, request, newError(http.StatusNotFound, "Media proxying is off", nil))
 		return
 	}
-	t.Execute(response, page)
+	vars := mux.Vars(request)
+	err := proxy.Serve(response, request, vars["id"], vars["rendition"])
+	if err == media.ErrUnknown {
+		writeError(response, request, newError(http.StatusNotFound, "No such gif", err))
+		return
+	}
+	if err != nil {
+		writeError(response, request, newError(http.StatusBadGateway, "Couldn't fetch that gif", err))
+	}
+}
+
+// LibraryHandler serves files from the local gif library.
+func LibraryHandler(response http.ResponseWriter, request *http.Request) {
+	file := mux.Vars(request)["file"]
+	ext := filepath.Ext(file)
+	if library != nil {
+		if path, ok := library.Open(strings.TrimSuffix(file, ext), ext); ok {
+			http.ServeFile(response, request, path)
+			return
+		}
+	}
+	writeError(response, request, newError(http.StatusNotFound, "No such gif", nil))
 }
 
 func GifHandler(response http.ResponseWriter, request *http.Request) {
 	request.ParseForm()
 	q := request.Form["q"]
 	if len(q) < 1 {
-		writeError(response, errors.New("No query specified"), "No query specified")
+		writeError(response, request, newError(http.StatusBadRequest, "No query specified", nil))
 		return
 	}
 
 	query := q[0]
 
-	apiKey := os.Getenv("GIPHY_API_KEY")
-	if apiKey == "" {
-		writeError(response, errors.New("y u no set GIPHY_API_KEY???"), "An unknown error occured")
+	opts, prefs, ok := browseOptions(response, request)
+	if !ok {
 		return
 	}
 
 	fmt.Println(q)
-	resp, err := http.Get("http://api.giphy.com/v1/gifs/search?q=" + url.QueryEscape(query) + "&api_key=" + apiKey)
+	results, n, err := search(sessionID(response, request), query, opts)
 	if err != nil {
-		writeError(response, err, "An unknown error occured")
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		writeError(response, err, "An unknown error occured")
-		return
-	}
-
-	var giphyResp jsn.Data
-	if err = json.Unmarshal(body, &giphyResp); err != nil {
-		writeError(response, err, "An unknown error occured")
-		return
-	}
-
-	var data []interface{}
-	if data, err = giphyResp.Array("data"); err != nil {
-		writeError(response, err, "An unknown error occured")
-		return
-	}
-	if len(data) == 0 {
-		writeError(response, errors.New("no can haz"), "No images could be found for your query :(")
+		writeError(response, request, err)
 		return
 	}
 
-	urls := make([]string, len(data))
+	// The pick depends on the session's history, so don't let anyone cache it.
+	response.Header().Set("Cache-Control", "no-store")
 
-	for i, img := range data {
-		var image map[string]interface{}
-		var ok bool
-		if image, ok = img.(map[string]interface{}); !ok {
-			writeError(response, err, "An unknown error occured")
-			return
-		}
-		if urls[i], err = jsn.Data(image).String("images.original.url"); err != nil {
-			writeError(response, err, "An unknown error occured")
-			return
-		}
-	}
-
-	t, err := template.ParseFiles("gif.html")
-	if err != nil {
-		writeError(response, err, "An unknown error occured")
+	if wantsJSON(request) {
+		writeJSON(response, struct {
+			Query   string     `json:"query"`
+			Picked  int        `json:"picked"`
+			Results []gifs.Gif `json:"results"`
+		}{query, n, results})
 		return
 	}
 
-	n := rand.Intn(len(urls))
-	p := struct{ Urls []string }{Urls: []string{urls[n]}}
-	t.Execute(response, &p)
+	m := templateMedia(results[n], prefs)
+	m.Permalink = permalink(results[n], query)
+	renderGifs(response, request, gifPage{Gifs: []gifMedia{m}})
 }
 
 func HotwaterBlingHandler(response http.ResponseWriter, request *http.Request) {
 	t, err := template.ParseFiles("bling/hotwater.html")
 	if err != nil {
-		writeError(response, err, "An unknown error occured")
+		writeError(response, request, err)
 		return
 	}
 	t.Execute(response, nil)